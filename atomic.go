@@ -0,0 +1,35 @@
+package aferocopy
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/afero"
+)
+
+const maxTempFileAttempts = 100
+
+// createTempFile creates a temporary file next to dest, so that it can be renamed over dest once it is written.
+func createTempFile(fs afero.Fs, dest string) (afero.File, string, error) {
+	for i := 0; ; i++ {
+		name := siblingName(dest, "tmp")
+
+		f, err := fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			return f, name, nil
+		}
+
+		if !os.IsExist(err) || i == maxTempFileAttempts {
+			return nil, "", err
+		}
+	}
+}
+
+// siblingName returns a random hidden name next to path, like ".name.random.ext".
+func siblingName(path, ext string) string {
+	dir, base := filepath.Split(filepath.Clean(path))
+
+	return filepath.Join(dir, "."+base+"."+strconv.FormatUint(rand.Uint64(), 36)+"."+ext) //nolint: gosec
+}
@@ -0,0 +1,112 @@
+package aferocopy
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dirNames(t *testing.T, fs afero.Fs, dir string) []string {
+	t.Helper()
+
+	infos, err := afero.ReadDir(fs, dir)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(infos))
+
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+
+	return names
+}
+
+func TestOptions_Atomic(t *testing.T) {
+	t.Parallel()
+
+	srcFs := afero.NewMemMapFs()
+	destFs := &journalFs{Fs: afero.NewMemMapFs()}
+
+	require.NoError(t, afero.WriteFile(srcFs, "/src/a.txt", []byte("new content"), 0o640))
+	require.NoError(t, afero.WriteFile(destFs.Fs, "/dest/a.txt", []byte("old"), 0o644))
+
+	err := Copy("/src", "/dest", Options{SrcFs: srcFs, DestFs: destFs, Atomic: true, Sync: true})
+	require.NoError(t, err)
+
+	content, err := afero.ReadFile(destFs, "/dest/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "new content", string(content))
+
+	info, err := destFs.Stat("/dest/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode())
+
+	assert.Equal(t, []string{"a.txt"}, dirNames(t, destFs, "/dest"))
+
+	for _, entry := range destFs.journal {
+		assert.NotEqual(t, "create /dest/a.txt", entry, "destination must not be written in place")
+	}
+}
+
+func TestOptions_Atomic_Failure(t *testing.T) {
+	t.Parallel()
+
+	srcFs := afero.NewMemMapFs()
+	destFs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(srcFs, "/src/a.txt", []byte("new content"), 0o644))
+	require.NoError(t, afero.WriteFile(destFs, "/dest/a.txt", []byte("old"), 0o644))
+
+	err := Copy("/src", "/dest", Options{SrcFs: &failingReadFs{Fs: srcFs}, DestFs: destFs, Atomic: true})
+	require.Error(t, err)
+
+	var copyErr *CopyError
+
+	require.ErrorAs(t, err, &copyErr)
+	assert.Equal(t, "/dest/a.txt", copyErr.Dest)
+
+	content, err := afero.ReadFile(destFs, "/dest/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(content))
+
+	assert.Equal(t, []string{"a.txt"}, dirNames(t, destFs, "/dest"), "temporary file must be removed")
+}
+
+func TestOptions_Atomic_PreserveTimes(t *testing.T) {
+	opt := Options{Atomic: true, PreserveTimes: true}
+	err := Copy("resources/fixtures/data/case09", "resources/test/data.copy/case09-atomic", opt)
+	require.NoError(t, err)
+
+	orig, err := os.Stat("resources/fixtures/data/case09/README.md")
+	require.NoError(t, err)
+
+	copied, err := os.Stat("resources/test/data.copy/case09-atomic/README.md")
+	require.NoError(t, err)
+
+	assert.Equal(t, orig.ModTime().Unix(), copied.ModTime().Unix())
+	assert.Equal(t, orig.Mode(), copied.Mode())
+}
+
+func TestPlan_Atomic(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("a"), 0o644))
+
+	ops, err := Plan("/src/a.txt", "/dest/a.txt", Options{SrcFs: fs, Atomic: true})
+	require.NoError(t, err)
+	require.Len(t, ops, 4)
+
+	temp := ops[1].Path
+
+	assert.Equal(t, Operation{Type: OpMkdir, Path: "/dest", Mode: os.ModePerm}, ops[0])
+	assert.Equal(t, OpCreateFile, ops[1].Type)
+	assert.True(t, strings.HasPrefix(temp, "/dest/.a.txt."), temp)
+	assert.Equal(t, Operation{Type: OpChmod, Path: temp, Mode: 0o644}, ops[2])
+	assert.Equal(t, Operation{Type: OpRename, Path: temp, Target: "/dest/a.txt"}, ops[3])
+}
@@ -0,0 +1,216 @@
+package aferocopy
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// BackupMode represents how to back up the existing destination files before overwriting them.
+type BackupMode int
+
+const (
+	// NoBackup overwrites the existing files without any backup (default behavior).
+	NoBackup BackupMode = iota
+	// SimpleBackup renames the existing file with Options.BackupSuffix, like "file~". The previous backup, if any, is
+	// overwritten.
+	SimpleBackup
+	// NumberedBackup renames the existing file with the next number, like "file.~1~", "file.~2~".
+	NumberedBackup
+)
+
+const defaultBackupSuffix = "~"
+
+// BackupEntry is an existing destination file that is backed up before being overwritten.
+type BackupEntry struct {
+	Dest   string
+	Backup string
+}
+
+// backupIndex is the numbered backups of the destination directories, so that each directory is read once for all
+// of its files.
+type backupIndex struct {
+	mu   sync.Mutex
+	dirs map[string]map[string][]int
+}
+
+func newBackupIndex() *backupIndex {
+	return &backupIndex{dirs: make(map[string]map[string][]int)}
+}
+
+// numbers returns the numbers of the existing numbered backups of dest, in ascending order, then calls update to
+// replace them.
+func (x *backupIndex) numbers(src, dest string, opt Options, update func(numbers []int) ([]int, error)) error {
+	dir, name := filepath.Split(dest)
+	dir = filepath.Clean(dir)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	backups, ok := x.dirs[dir]
+	if !ok {
+		contents, err := afero.ReadDir(opt.DestFs, dir)
+		if err != nil {
+			return destError("readdir", src, dir, err)
+		}
+
+		backups = make(map[string][]int)
+
+		for _, content := range contents {
+			if orig, i, ok := parseNumberedBackup(content.Name()); ok {
+				backups[orig] = append(backups[orig], i)
+			}
+		}
+
+		for _, numbers := range backups {
+			sort.Ints(numbers)
+		}
+
+		x.dirs[dir] = backups
+	}
+
+	numbers, err := update(backups[name])
+	backups[name] = numbers
+
+	return err
+}
+
+// backupFile backs up the existing dest following Options.Backup, then removes the oldest numbered backups beyond
+// Options.MaxBackups. The backup is dest renamed, or a hard link to it, or a copy of it, when dest must stay in place
+// until another file is renamed over it.
+func backupFile(src, dest string, inPlace bool, opt Options) error {
+	if opt.Backup == SimpleBackup {
+		return createBackup(src, dest, dest+opt.BackupSuffix, inPlace, opt)
+	}
+
+	index := opt.backups
+	if index == nil {
+		index = newBackupIndex()
+	}
+
+	return index.numbers(src, dest, opt, func(numbers []int) ([]int, error) {
+		next := 1
+		if len(numbers) > 0 {
+			next = numbers[len(numbers)-1] + 1
+		}
+
+		if err := createBackup(src, dest, numberedBackup(dest, next), inPlace, opt); err != nil {
+			return numbers, err
+		}
+
+		numbers = append(numbers[:len(numbers):len(numbers)], next)
+
+		for opt.MaxBackups > 0 && len(numbers) > opt.MaxBackups {
+			if err := opt.DestFs.Remove(numberedBackup(dest, numbers[0])); err != nil && !os.IsNotExist(err) {
+				return numbers, destError("remove", src, numberedBackup(dest, numbers[0]), err)
+			}
+
+			numbers = numbers[1:]
+		}
+
+		return numbers, nil
+	})
+}
+
+// createBackup renames dest to backup, or links or copies it there when it stays in place.
+func createBackup(src, dest, backup string, inPlace bool, opt Options) error {
+	if !inPlace {
+		if err := opt.DestFs.Rename(dest, backup); err != nil {
+			return destError("rename", src, dest, err)
+		}
+	} else if err := duplicateFile(src, dest, backup, opt); err != nil {
+		return err
+	}
+
+	opt.result.backup(dest, backup)
+	opt.written.add(backup)
+
+	return nil
+}
+
+// duplicateFile creates backup as a hard link to dest, or as a copy of it, with its permission and times, when the
+// filesystem cannot link. An existing backup is replaced.
+func duplicateFile(src, dest, backup string, opt Options) (err error) {
+	destFs := opt.DestFs
+
+	if err := destFs.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return destError("remove", src, backup, err)
+	}
+
+	if err := link(destFs, dest, backup); err == nil {
+		return nil
+	}
+
+	info, err := stat(destFs, dest)
+	if err != nil {
+		return destError("stat", src, dest, err)
+	}
+
+	r, err := destFs.Open(dest)
+	if err != nil {
+		return destError("open", src, dest, err)
+	}
+
+	defer closeFile(r, &err, func(err error) error {
+		return destError("close", src, dest, err)
+	})
+
+	w, err := destFs.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return destError("create", src, backup, err)
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		ignore(w.Close())
+
+		return destError("write", src, backup, err)
+	}
+
+	if err := w.Close(); err != nil {
+		return destError("close", src, backup, err)
+	}
+
+	return destError("chtimes", src, backup, destFs.Chtimes(backup, info.ModTime(), info.ModTime()))
+}
+
+// backupOf returns the name of the file that name is a backup of, following Options.Backup.
+func backupOf(name string, opt Options) (string, bool) {
+	switch opt.Backup {
+	case SimpleBackup:
+		return strings.CutSuffix(name, opt.BackupSuffix)
+
+	case NumberedBackup:
+		orig, _, ok := parseNumberedBackup(name)
+
+		return orig, ok
+
+	case NoBackup:
+	}
+
+	return "", false
+}
+
+// parseNumberedBackup returns the name of the file that name is a numbered backup of, and its number.
+func parseNumberedBackup(name string) (string, int, bool) {
+	i := strings.LastIndex(name, ".~")
+	if i <= 0 || len(name) < i+4 || !strings.HasSuffix(name, "~") {
+		return "", 0, false
+	}
+
+	n, err := strconv.Atoi(name[i+2 : len(name)-1])
+	if err != nil || n <= 0 {
+		return "", 0, false
+	}
+
+	return name[:i], n, true
+}
+
+func numberedBackup(dest string, i int) string {
+	return dest + ".~" + strconv.Itoa(i) + "~"
+}
@@ -0,0 +1,236 @@
+package aferocopy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptions_Backup_Simple(t *testing.T) {
+	t.Parallel()
+
+	for _, atomic := range []bool{false, true} {
+		fs := afero.NewMemMapFs()
+
+		require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("new"), 0o644))
+		require.NoError(t, afero.WriteFile(fs, "/src/b.txt", []byte("b"), 0o644))
+		require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte("old"), 0o644))
+		require.NoError(t, afero.WriteFile(fs, "/dest/a.txt.bak", []byte("older"), 0o644))
+
+		result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+			SrcFs:        fs,
+			Atomic:       atomic,
+			Backup:       SimpleBackup,
+			BackupSuffix: ".bak",
+		})
+		require.NoError(t, err)
+
+		expected := map[string]string{
+			"/dest/a.txt":     "new",
+			"/dest/a.txt.bak": "old",
+			"/dest/b.txt":     "b",
+		}
+
+		for name, want := range expected {
+			content, err := afero.ReadFile(fs, name)
+			require.NoError(t, err)
+			assert.Equal(t, want, string(content), name)
+		}
+
+		assert.Equal(t, []BackupEntry{{Dest: "/dest/a.txt", Backup: "/dest/a.txt.bak"}}, result.Backups)
+	}
+}
+
+// renameCheckingFs records the destinations that do not exist when a file is renamed over them.
+type renameCheckingFs struct {
+	afero.Fs
+
+	mu      sync.Mutex
+	missing []string
+}
+
+func (fs *renameCheckingFs) Rename(oldname, newname string) error {
+	if _, err := fs.Stat(newname); os.IsNotExist(err) {
+		fs.mu.Lock()
+		fs.missing = append(fs.missing, newname)
+		fs.mu.Unlock()
+	}
+
+	return fs.Fs.Rename(oldname, newname)
+}
+
+func (fs *renameCheckingFs) LinkIfPossible(oldname, newname string) error {
+	return link(fs.Fs, oldname, newname)
+}
+
+func TestOptions_Backup_Atomic(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		fs       afero.Fs
+		dir      string
+	}{
+		{
+			// The backup is a copy.
+			scenario: "copy",
+			fs:       afero.NewMemMapFs(),
+			dir:      "/",
+		},
+		{
+			// The backup is a hard link.
+			scenario: "link",
+			fs:       afero.NewOsFs(),
+			dir:      t.TempDir(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			src, dest := filepath.Join(tc.dir, "src"), filepath.Join(tc.dir, "dest")
+
+			require.NoError(t, tc.fs.MkdirAll(src, 0o755))
+			require.NoError(t, tc.fs.MkdirAll(dest, 0o755))
+			require.NoError(t, afero.WriteFile(tc.fs, filepath.Join(src, "a.txt"), []byte("new"), 0o644))
+			require.NoError(t, afero.WriteFile(tc.fs, filepath.Join(dest, "a.txt"), []byte("old"), 0o600))
+
+			fs := &renameCheckingFs{Fs: tc.fs}
+
+			for _, mode := range []BackupMode{SimpleBackup, NumberedBackup} {
+				err := Copy(src, dest, Options{SrcFs: fs, Atomic: true, Backup: mode})
+				require.NoError(t, err)
+			}
+
+			// The destination is never missing, the temporary file is renamed over it.
+			assert.Empty(t, fs.missing)
+			assert.Equal(t, []string{"a.txt", "a.txt.~1~", "a.txt~"}, dirNames(t, tc.fs, dest))
+
+			// The backup of the original file keeps its permission.
+			expected := map[string]string{
+				"a.txt":     "-rw-r--r-- new",
+				"a.txt~":    "-rw------- old",
+				"a.txt.~1~": "-rw-r--r-- new",
+			}
+
+			for name, want := range expected {
+				content, err := afero.ReadFile(tc.fs, filepath.Join(dest, name))
+				require.NoError(t, err)
+
+				info, err := tc.fs.Stat(filepath.Join(dest, name))
+				require.NoError(t, err)
+				assert.Equal(t, want, info.Mode().String()+" "+string(content), name)
+			}
+		})
+	}
+}
+
+func TestOptions_Backup_DefaultSuffix(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("new"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte("old"), 0o644))
+
+	err := Copy("/src", "/dest", Options{SrcFs: fs, Backup: SimpleBackup})
+	require.NoError(t, err)
+
+	content, err := afero.ReadFile(fs, "/dest/a.txt~")
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(content))
+}
+
+func TestOptions_Backup_Numbered(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte("v0"), 0o644))
+
+	for _, v := range []string{"v1", "v2", "v3", "v4"} {
+		require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte(v), 0o644))
+
+		err := Copy("/src", "/dest", Options{SrcFs: fs, Backup: NumberedBackup, MaxBackups: 2})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"a.txt", "a.txt.~3~", "a.txt.~4~"}, dirNames(t, fs, "/dest"))
+
+	expected := map[string]string{
+		"/dest/a.txt":     "v4",
+		"/dest/a.txt.~3~": "v2",
+		"/dest/a.txt.~4~": "v3",
+	}
+
+	for name, want := range expected {
+		content, err := afero.ReadFile(fs, name)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(content), name)
+	}
+}
+
+func TestOptions_Backup_Numbered_ReadDirOnce(t *testing.T) {
+	t.Parallel()
+
+	files := make(map[string]string)
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		files["/src/"+name] = "new"
+		files["/dest/"+name] = "old"
+	}
+
+	files["/dest/a.txt.~1~"] = "older"
+
+	fs := &openRecordingFs{Fs: newFixtureFs(t, files)}
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{SrcFs: fs, Backup: NumberedBackup})
+	require.NoError(t, err)
+
+	// The destination directory is read once for all of its backups.
+	var opened int
+
+	for _, name := range fs.opened {
+		if name == "/dest" {
+			opened++
+		}
+	}
+
+	assert.Equal(t, 1, opened)
+	assert.Len(t, result.Backups, 4)
+	assert.Contains(t, result.Backups, BackupEntry{Dest: "/dest/a.txt", Backup: "/dest/a.txt.~2~"})
+	assert.Contains(t, result.Backups, BackupEntry{Dest: "/dest/b.txt", Backup: "/dest/b.txt.~1~"})
+
+	for _, name := range dirNames(t, fs, "/dest") {
+		assert.False(t, strings.HasSuffix(name, ".tmp"), name)
+	}
+}
+
+func TestOptions_Backup_NotOverwritten(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("a"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/b.txt", []byte("b"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte("a"), 0o644))
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:  fs,
+		Update: UpdateChecksum,
+		Backup: NumberedBackup,
+	})
+	require.NoError(t, err)
+
+	// The file that is up to date is not overwritten, and the missing one has nothing to back up.
+	assert.Empty(t, result.Backups)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, dirNames(t, fs, "/dest"))
+}
@@ -0,0 +1,74 @@
+package aferocopy
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// basePathFs is an afero.BasePathFs that creates hard links, named pipes and device nodes with its source.
+type basePathFs struct {
+	*afero.BasePathFs
+
+	source afero.Fs
+}
+
+var (
+	_ HardLinker = (*basePathFs)(nil)
+	_ Mkfifoer   = (*basePathFs)(nil)
+	_ Mknoder    = (*basePathFs)(nil)
+)
+
+// NewBasePathFs returns an afero.BasePathFs over source, that also creates hard links, named pipes and device nodes
+// with source, if it can.
+func NewBasePathFs(source afero.Fs, path string) afero.Fs {
+	return &basePathFs{
+		BasePathFs: afero.NewBasePathFs(source, path).(*afero.BasePathFs), //nolint: forcetypeassert
+		source:     source,
+	}
+}
+
+func (fs *basePathFs) LinkIfPossible(oldname, newname string) error {
+	oldpath, err := fs.RealPath(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+
+	newpath, err := fs.RealPath(newname)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+
+	if err := link(fs.source, oldpath, newpath); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errors.Unwrap(err)}
+	}
+
+	return nil
+}
+
+func (fs *basePathFs) MkfifoIfPossible(name string, mode os.FileMode) error {
+	path, err := fs.RealPath(name)
+	if err != nil {
+		return &os.PathError{Op: "mkfifo", Path: name, Err: err}
+	}
+
+	if err := mkfifo(fs.source, path, mode); err != nil {
+		return &os.PathError{Op: "mkfifo", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	return nil
+}
+
+func (fs *basePathFs) MknodIfPossible(name string, mode os.FileMode, dev uint64) error {
+	path, err := fs.RealPath(name)
+	if err != nil {
+		return &os.PathError{Op: "mknod", Path: name, Err: err}
+	}
+
+	if err := mknod(fs.source, path, mode, dev); err != nil {
+		return &os.PathError{Op: "mknod", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	return nil
+}
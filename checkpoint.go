@@ -0,0 +1,376 @@
+package aferocopy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	// checkpointInterval is how many bytes of a file are copied between two checkpoints of its offset.
+	checkpointInterval = 8 << 20
+
+	checkpointStart   = "start"
+	checkpointDone    = "done"
+	checkpointPartial = "partial"
+)
+
+// checkpointEntry is a line of the checkpoint journal.
+type checkpointEntry struct {
+	Op     string `json:"op"`
+	Src    string `json:"src"`
+	Dest   string `json:"dest"`
+	Path   string `json:"path,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+}
+
+// checkpoint records the entries that are copied, and how far the files are copied, in a journal. So that a copy
+// can be resumed from where it stopped. A nil checkpoint records nothing.
+type checkpoint struct {
+	fs   afero.Fs
+	path string
+	sync bool
+
+	mu        sync.Mutex
+	journal   afero.File
+	done      map[[2]string]struct{}
+	partial   map[[2]string]checkpointEntry
+	discarded bool
+}
+
+// openCheckpoint loads the journal at path, if any, and opens it to record the progress of the copy of src to dest.
+func openCheckpoint(fs afero.Fs, path, src, dest string, sync bool) (*checkpoint, error) {
+	c := &checkpoint{
+		fs:      fs,
+		path:    path,
+		sync:    sync,
+		done:    make(map[[2]string]struct{}),
+		partial: make(map[[2]string]checkpointEntry),
+	}
+
+	started, err := c.load(src, dest)
+	if err != nil {
+		return nil, &CopyError{Op: "checkpoint", Src: src, Dest: dest, Err: err}
+	}
+
+	if err := fs.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, &CopyError{Op: "checkpoint", Src: src, Dest: dest, Err: err}
+	}
+
+	if c.journal, err = fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644); err != nil {
+		return nil, &CopyError{Op: "checkpoint", Src: src, Dest: dest, Err: err}
+	}
+
+	if !started {
+		if err := c.write(checkpointEntry{Op: checkpointStart, Src: src, Dest: dest}); err != nil {
+			ignore(c.journal.Close())
+
+			return nil, &CopyError{Op: "checkpoint", Src: src, Dest: dest, Err: err}
+		}
+	}
+
+	return c, nil
+}
+
+// load reads the existing journal, and tells whether it is started.
+// The lines that cannot be read, like the last one when the copy is interrupted while writing it, are ignored.
+func (c *checkpoint) load(src, dest string) (bool, error) {
+	data, err := afero.ReadFile(c.fs, c.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	started := false
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var e checkpointEntry
+
+		if err := json.Unmarshal(line, &e); err != nil {
+			continue
+		}
+
+		key := [2]string{e.Src, e.Dest}
+
+		switch e.Op {
+		case checkpointStart:
+			if e.Src != src || e.Dest != dest {
+				return false, fmt.Errorf("checkpoint %s is for %s -> %s", c.path, e.Src, e.Dest) //nolint: err113
+			}
+
+			started = true
+
+		case checkpointDone:
+			c.done[key] = struct{}{}
+			delete(c.partial, key)
+
+		case checkpointPartial:
+			c.partial[key] = e
+		}
+	}
+
+	return started, nil
+}
+
+// write must be called with the lock held, or before the copy starts.
+func (c *checkpoint) write(e checkpointEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.journal.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	if c.sync {
+		return c.journal.Sync()
+	}
+
+	return nil
+}
+
+func (c *checkpoint) record(e checkpointEntry) error {
+	if c == nil || c.journal == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.write(e); err != nil {
+		return &CopyError{Op: "checkpoint", Src: e.Src, Dest: e.Dest, Err: err}
+	}
+
+	return nil
+}
+
+// isDone tells whether src is already copied to dest.
+func (c *checkpoint) isDone(src, dest string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.done[[2]string{src, dest}]
+
+	return ok
+}
+
+// finish records that src is copied to dest.
+func (c *checkpoint) finish(src, dest string) error {
+	return c.record(checkpointEntry{Op: checkpointDone, Src: src, Dest: dest})
+}
+
+// offset returns where the copy of src to dest stopped, and the file it is copied to.
+func (c *checkpoint) offset(src, dest string) (string, int64) {
+	if c == nil {
+		return "", 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.partial[[2]string{src, dest}]
+
+	return e.Path, e.Offset
+}
+
+// readOnly returns a checkpoint that tells what is copied, but records nothing.
+func (c *checkpoint) readOnly() *checkpoint {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return &checkpoint{done: c.done, partial: c.partial}
+}
+
+// discard makes close remove the journal even if the copy fails, because there is nothing to resume.
+func (c *checkpoint) discard() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.discarded = true
+}
+
+// close closes the journal, and removes it if the copy succeeded.
+func (c *checkpoint) close(err error) error {
+	if c == nil {
+		return err
+	}
+
+	cerr := c.journal.Close()
+
+	if err != nil && !c.discarded {
+		return err
+	}
+
+	if cerr == nil {
+		cerr = c.fs.Remove(c.path)
+	}
+
+	if cerr != nil {
+		return errors.Join(err, &CopyError{Op: "checkpoint", Src: c.path, Err: cerr})
+	}
+
+	return err
+}
+
+// file returns the destination file that records its offset every checkpointInterval bytes, from offset.
+func (c *checkpoint) file(src, dest, path string, offset int64, f afero.File) afero.File {
+	if c == nil || c.journal == nil {
+		return f
+	}
+
+	return &checkpointFile{File: f, c: c, src: src, dest: dest, path: path, offset: offset, next: offset + checkpointInterval}
+}
+
+// checkpointFile records the offset of the file being written.
+type checkpointFile struct {
+	afero.File
+
+	c      *checkpoint
+	src    string
+	dest   string
+	path   string
+	offset int64
+	next   int64
+}
+
+func (f *checkpointFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.offset += int64(n)
+
+	if err == nil && f.offset >= f.next {
+		f.next = f.offset + checkpointInterval
+		err = f.save()
+	}
+
+	return n, err
+}
+
+// Seek follows the offset of the file, when the holes of a sparse file are skipped.
+func (f *checkpointFile) Seek(offset int64, whence int) (int64, error) {
+	n, err := f.File.Seek(offset, whence)
+	if err == nil {
+		f.offset = n
+	}
+
+	return n, err
+}
+
+// save records the offset of the file.
+func (f *checkpointFile) save() error {
+	if f.offset == 0 {
+		return nil
+	}
+
+	return f.c.record(checkpointEntry{Op: checkpointPartial, Src: f.src, Dest: f.dest, Path: f.path, Offset: f.offset})
+}
+
+// resumeFile opens the file that the copy of src to dest stopped writing, positioned where it stopped. It returns a
+// nil file if there is nothing to resume, or if the file does not start like the source anymore.
+func resumeFile(src, dest string, opt Options) (afero.File, string, int64, error) {
+	path, offset := opt.checkpoint.offset(src, dest)
+	if offset == 0 || opt.Atomic || opt.planning || opt.transform != nil {
+		return nil, "", 0, nil
+	}
+
+	same, err := samePrefix(src, path, offset, opt)
+	if err != nil || !same {
+		return nil, "", 0, err
+	}
+
+	f, err := opt.DestFs.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, "", 0, destError("open", src, path, err)
+	}
+
+	// Drop what is written after the checkpoint.
+	if err := f.Truncate(offset); err != nil {
+		ignore(f.Close())
+
+		return nil, "", 0, destError("truncate", src, path, err)
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		ignore(f.Close())
+
+		return nil, "", 0, destError("seek", src, path, err)
+	}
+
+	return f, path, offset, nil
+}
+
+// samePrefix tells whether the first n bytes of the destination file are the same as the source.
+func samePrefix(src, dest string, n int64, opt Options) (same bool, err error) {
+	info, err := stat(opt.DestFs, dest)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, destError("stat", src, dest, err)
+	}
+
+	if !info.Mode().IsRegular() || info.Size() < n {
+		return false, nil
+	}
+
+	s, err := opt.SrcFs.Open(src)
+	if err != nil {
+		return false, srcError("open", src, dest, err)
+	}
+
+	defer closeFile(s, &err, func(err error) error {
+		return srcError("close", src, dest, err)
+	})
+
+	d, err := opt.DestFs.Open(dest)
+	if err != nil {
+		return false, destError("open", src, dest, err)
+	}
+
+	defer closeFile(d, &err, func(err error) error {
+		return destError("close", src, dest, err)
+	})
+
+	const size = 32 * 1024
+
+	sbuf, dbuf := make([]byte, size), make([]byte, size)
+
+	for n > 0 {
+		chunk := min(n, size)
+
+		if _, err := io.ReadFull(s, sbuf[:chunk]); err != nil {
+			return false, srcError("read", src, dest, err)
+		}
+
+		if _, err := io.ReadFull(d, dbuf[:chunk]); err != nil {
+			return false, destError("read", src, dest, err)
+		}
+
+		if !bytes.Equal(sbuf[:chunk], dbuf[:chunk]) {
+			return false, nil
+		}
+
+		n -= chunk
+	}
+
+	return true, nil
+}
@@ -0,0 +1,166 @@
+package aferocopy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// interruptingFs fails to read a file after the given number of bytes.
+type interruptingFs struct {
+	afero.Fs
+
+	name  string
+	after int64
+}
+
+func (fs *interruptingFs) Open(name string) (afero.File, error) {
+	f, err := fs.Fs.Open(name)
+	if err != nil || name != fs.name {
+		return f, err
+	}
+
+	return &interruptingFile{File: f, left: fs.after}, nil
+}
+
+type interruptingFile struct {
+	afero.File
+
+	left int64
+}
+
+func (f *interruptingFile) Read(p []byte) (int, error) {
+	if f.left <= 0 {
+		return 0, errors.New("interrupted")
+	}
+
+	if int64(len(p)) > f.left {
+		p = p[:f.left]
+	}
+
+	n, err := f.File.Read(p)
+	f.left -= int64(n)
+
+	return n, err
+}
+
+// checkpointBig is a file bigger than the copy buffer of checkpointOptions.
+var checkpointBig = strings.Repeat("0123456789", 1000)
+
+// checkpointFixture is a source with a big file between two small ones.
+var checkpointFixture = map[string]string{
+	"/src/a.txt":   "a",
+	"/src/big.bin": checkpointBig,
+	"/src/c.txt":   "c",
+}
+
+func checkpointOptions(srcFs, destFs, journalFs afero.Fs) Options {
+	return Options{
+		SrcFs:          srcFs,
+		DestFs:         destFs,
+		Checkpoint:     "/journal/copy.json",
+		CheckpointFs:   journalFs,
+		CopyBufferSize: 1024,
+	}
+}
+
+func TestOptions_Checkpoint_Resume(t *testing.T) {
+	t.Parallel()
+
+	srcFs := newFixtureFs(t, checkpointFixture)
+	destFs := afero.NewMemMapFs()
+	journalFs := afero.NewMemMapFs()
+
+	err := Copy("/src", "/dest", checkpointOptions(&interruptingFs{Fs: srcFs, name: "/src/big.bin", after: 4096}, destFs, journalFs))
+	require.ErrorContains(t, err, "interrupted")
+
+	_, err = journalFs.Stat("/journal/copy.json")
+	require.NoError(t, err, "journal must be kept")
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", checkpointOptions(srcFs, destFs, journalFs))
+	require.NoError(t, err)
+
+	// Only the rest of the big file and the last file are copied.
+	assert.Equal(t, int64(len(checkpointBig)-4096+1), result.Bytes)
+	assert.Equal(t, []SkippedEntry{{Src: "/src/a.txt", Dest: "/dest/a.txt", Reason: SkippedCheckpoint}}, result.Skipped)
+
+	content, err := afero.ReadFile(destFs, "/dest/big.bin")
+	require.NoError(t, err)
+	assert.Equal(t, checkpointBig, string(content))
+
+	_, err = journalFs.Stat("/journal/copy.json")
+	assert.True(t, os.IsNotExist(err), "journal must be removed")
+}
+
+func TestOptions_Checkpoint_PrefixChanged(t *testing.T) {
+	t.Parallel()
+
+	srcFs := newFixtureFs(t, checkpointFixture)
+	destFs := afero.NewMemMapFs()
+
+	err := Copy("/src", "/dest", checkpointOptions(&interruptingFs{Fs: srcFs, name: "/src/big.bin", after: 4096}, destFs, destFs))
+	require.Error(t, err)
+
+	require.NoError(t, afero.WriteFile(destFs, "/dest/big.bin", []byte("changed"), 0o644))
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", checkpointOptions(srcFs, destFs, destFs))
+	require.NoError(t, err)
+
+	// The big file is copied again from the start.
+	assert.Equal(t, int64(len(checkpointBig)+1), result.Bytes)
+
+	content, err := afero.ReadFile(destFs, "/dest/big.bin")
+	require.NoError(t, err)
+	assert.Equal(t, checkpointBig, string(content))
+}
+
+func TestOptions_Checkpoint_Canceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	big := strings.Repeat("a", 4096)
+	fs := newFixtureFs(t, map[string]string{"/src/big.bin": big})
+
+	opt := checkpointOptions(&cancelFs{Fs: fs, cancel: cancel}, fs, fs)
+	opt.CopyBufferSize = 512
+
+	err := CopyContext(ctx, "/src", "/dest", opt)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// The file partially copied is kept to be resumed.
+	info, err := fs.Stat("/dest/big.bin")
+	require.NoError(t, err)
+	assert.Equal(t, int64(512), info.Size())
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", checkpointOptions(fs, fs, fs))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(4096-512), result.Bytes)
+
+	content, err := afero.ReadFile(fs, "/dest/big.bin")
+	require.NoError(t, err)
+	assert.Equal(t, big, string(content))
+}
+
+func TestOptions_Checkpoint_AnotherCopy(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, map[string]string{
+		"/src/a.txt":         "a",
+		"/journal/copy.json": `{"op":"start","src":"/other","dest":"/dest"}` + "\n",
+	})
+
+	err := Copy("/src", "/dest", checkpointOptions(fs, fs, fs))
+	require.EqualError(t, err, "checkpoint /src -> /dest: checkpoint /journal/copy.json is for /other -> /dest")
+
+	_, err = fs.Stat("/dest")
+	assert.True(t, os.IsNotExist(err))
+}
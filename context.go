@@ -0,0 +1,53 @@
+package aferocopy
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// contextReader stops reading as soon as the context is done.
+type contextReader struct {
+	ctx context.Context //nolint: containedctx
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p)
+}
+
+// newContextReader wraps the reader only when the context can be canceled,
+// so that io.CopyBuffer could still use the fast paths of the underlying reader otherwise.
+func newContextReader(ctx context.Context, r io.Reader) io.Reader {
+	if !cancelable(ctx) {
+		return r
+	}
+
+	return &contextReader{ctx: ctx, r: r}
+}
+
+// cancelable tells whether the context can be canceled.
+func cancelable(ctx context.Context) bool {
+	return ctx != nil && ctx.Done() != nil
+}
+
+// checkContext returns the error of the context, wrapped with the paths being copied, if the context is done.
+func checkContext(ctx context.Context, src, dest string) error {
+	if ctx == nil {
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return &CopyError{Op: "copy", Src: src, Dest: dest, Err: err}
+	}
+
+	return nil
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
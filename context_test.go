@@ -0,0 +1,101 @@
+package aferocopy
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cancelFs cancels the context once a file opened from it has been read.
+type cancelFs struct {
+	afero.Fs
+
+	cancel context.CancelFunc
+}
+
+func (fs *cancelFs) Open(name string) (afero.File, error) {
+	f, err := fs.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cancelFile{File: f, cancel: fs.cancel}, nil
+}
+
+type cancelFile struct {
+	afero.File
+
+	cancel context.CancelFunc
+}
+
+func (f *cancelFile) Read(p []byte) (int, error) {
+	defer f.cancel()
+
+	return f.File.Read(p)
+}
+
+func TestCopyContext_CanceledBeforeStart(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/file.txt", []byte("hello"), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := CopyContext(ctx, "/src", "/dest", Options{SrcFs: fs})
+
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = fs.Stat("/dest")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCopyContext_CanceledWhileCopyingFile(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srcFs := &cancelFs{Fs: afero.NewMemMapFs(), cancel: cancel}
+	destFs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(srcFs.Fs, "/src/file.txt", bytes.Repeat([]byte("a"), 4096), 0o644))
+
+	err := CopyContext(ctx, "/src", "/dest", Options{SrcFs: srcFs, DestFs: destFs, CopyBufferSize: 512})
+
+	require.ErrorIs(t, err, context.Canceled)
+
+	var copyErr *CopyError
+
+	require.ErrorAs(t, err, &copyErr)
+	assert.Equal(t, "/src/file.txt", copyErr.Src)
+	assert.Equal(t, "/dest/file.txt", copyErr.Dest)
+
+	_, err = destFs.Stat("/dest/file.txt")
+	assert.True(t, os.IsNotExist(err), "half-written file should be removed")
+}
+
+func TestCopyContext_NotCanceled(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/dir/file.txt", []byte("hello"), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := CopyContext(ctx, "/src", "/dest", Options{SrcFs: fs})
+	require.NoError(t, err)
+
+	content, err := afero.ReadFile(fs, "/dest/dir/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+}
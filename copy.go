@@ -1,9 +1,14 @@
 package aferocopy
 
 import (
+	"context"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/afero"
@@ -17,14 +22,72 @@ type timeSpec struct {
 
 // Copy copies src to dest, doesn't matter if src is a directory or a file.
 func Copy(src, dest string, opt ...Options) error {
+	return CopyContext(context.Background(), src, dest, opt...)
+}
+
+// CopyContext copies src to dest like Copy, but stops as soon as the context is done.
+// The cancellation is checked between the entries of a directory and while copying the content of a file. When it
+// happens, the error of the context is returned, wrapped with the path being copied, and the file being written is
+// removed.
+func CopyContext(ctx context.Context, src, dest string, opt ...Options) error {
+	return copyContext(ctx, src, dest, nil, opt...)
+}
+
+func copyContext(ctx context.Context, src, dest string, result *resultCollector, opt ...Options) error {
 	o := assureOptions(src, dest, opt...)
+	o.ctx = ctx
+
+	if err := checkContext(ctx, src, dest); err != nil {
+		return err
+	}
+
+	if err := checkPatterns(o); err != nil {
+		return err
+	}
 
 	info, err := stat(o.SrcFs, src)
 	if err != nil {
-		return err
+		return srcError("lstat", src, dest, err)
+	}
+
+	o.progress = newProgressTracker(o.OnProgress)
+	o.pool = newWorkerPool(o.Concurrency)
+	o.result = result
+
+	if o.Checkpoint != "" {
+		if o.checkpoint, err = openCheckpoint(o.CheckpointFs, o.Checkpoint, src, dest, o.Sync); err != nil {
+			return err
+		}
 	}
 
-	return switchboard(src, dest, info, o)
+	return o.checkpoint.close(copyWalk(src, dest, info, o))
+}
+
+// copyWalk walks src to copy it to dest, after scanning it if needed.
+func copyWalk(src, dest string, info os.FileInfo, o Options) error {
+	if o.progress != nil && o.PreScan {
+		entries, bytes, err := scan(src, info, o)
+		if err != nil {
+			return err
+		}
+
+		o.progress.setTotals(entries, bytes)
+	}
+
+	if !o.Transactional {
+		return walk(src, dest, info, o)
+	}
+
+	tx := newTxFs(o.DestFs, dest)
+	o.DestFs = tx.fs()
+
+	err := tx.end(walk(src, dest, info, o))
+	if err != nil && o.checkpoint != nil {
+		// Everything is rolled back, there is nothing to resume.
+		o.checkpoint.discard()
+	}
+
+	return err
 }
 
 func stat(fs afero.Fs, path string) (os.FileInfo, error) {
@@ -39,7 +102,19 @@ func stat(fs afero.Fs, path string) (os.FileInfo, error) {
 
 // switchboard switches proper copy functions regarding file type, etc...
 // If there would be anything else here, add a case to this switchboard.
-func switchboard(src, dest string, info os.FileInfo, opt Options) error {
+func switchboard(src, dest string, info os.FileInfo, opt Options) (err error) {
+	opt.progress.start(src, dest, info)
+
+	defer func() {
+		// A directory is only done if nothing failed in it, even when the copy continues on errors, and if the copy
+		// is not stopped by SkipAll.
+		if err == nil && (!info.IsDir() || (opt.failures.empty() && !opt.stopped.Load())) {
+			err = opt.checkpoint.finish(src, dest)
+		}
+
+		opt.progress.finish(src, dest, info, err)
+	}()
+
 	switch {
 	case info.Mode()&os.ModeSymlink != 0:
 		return onSymlink(src, dest, opt)
@@ -48,10 +123,17 @@ func switchboard(src, dest string, info os.FileInfo, opt Options) error {
 		return copyDir(src, dest, info, opt)
 
 	case info.Mode()&os.ModeNamedPipe != 0:
-		return copyPipe(opt.DestFs, dest, info)
+		return copyPipe(src, dest, info, opt)
+
+	case info.Mode()&os.ModeDevice != 0:
+		return copyDevice(src, dest, info, opt)
+
+	case info.Mode()&(os.ModeSocket|os.ModeIrregular) != 0:
+		// Sockets and the files of unknown types cannot be recreated, nor read.
+		return onSpecialFile("copy", src, dest, info, opt)
 
 	default:
-		return copyFile(src, dest, info, opt)
+		return copyOrLinkFile(src, dest, info, opt)
 	}
 }
 
@@ -59,52 +141,247 @@ func switchboard(src, dest string, info os.FileInfo, opt Options) error {
 // Because this "copy" could be called recursively,
 // "info" MUST be given here, NOT nil.
 func copyNextOrSkip(src, dest string, info os.FileInfo, opt Options) error {
-	skip, err := opt.Skip(opt.SrcFs, src)
-	if err != nil {
+	reason, out, err := leftOut(src, dest, info, opt)
+	if out {
+		opt.result.skip(src, dest, reason)
+
+		if opt.mapped {
+			opt.mapper.leave(dest)
+		}
+	}
+
+	// fs.SkipDir skips the directory, or the rest of the parent directory of a file, which may be reached through a
+	// symlink.
+	if errors.Is(err, fs.SkipDir) {
+		if info.IsDir() {
+			return nil
+		}
+
+		return errSkipRest
+	}
+
+	if err != nil || out {
 		return err
 	}
 
-	if skip {
-		return nil
+	// Only the entries that are copied take their mapped destination.
+	if opt.mapped {
+		if err := opt.mapper.claim(src, dest, info.IsDir()); err != nil {
+			return err
+		}
+
+		opt.mapped = false
+	}
+
+	if opt.checkpoint.isDone(src, dest) {
+		if _, err := stat(opt.DestFs, dest); err == nil {
+			opt.result.skip(src, dest, SkippedCheckpoint)
+
+			return nil
+		}
 	}
 
 	return switchboard(src, dest, info, opt)
 }
 
+// leftOut tells whether the entry src is left out of the copy, and why: by Options.Exclude or Options.Include, by
+// the ignore files, by Options.Skip or by Options.SkipEntry, which may also return fs.SkipDir or fs.SkipAll.
+func leftOut(src, dest string, info os.FileInfo, opt Options) (SkipReason, bool, error) {
+	if out, err := filtered(opt.rel, info, opt); err != nil || out {
+		return SkippedByFilter, out, err
+	}
+
+	if ignored(opt.rel, info, opt.ignores) {
+		return SkippedByIgnoreFile, true, nil
+	}
+
+	if skip, err := opt.Skip(opt.SrcFs, src); err != nil || skip {
+		return SkippedByCallback, skip && err == nil, err
+	}
+
+	if opt.SkipEntry == nil {
+		return 0, false, nil
+	}
+
+	skip, err := opt.SkipEntry(opt.SrcFs, src, info, dest, depth(opt.rel))
+
+	switch {
+	case isSkipErr(err):
+		return SkippedByCallback, true, err
+
+	case err != nil:
+		return 0, false, err
+	}
+
+	return SkippedByCallback, skip, nil
+}
+
+// errSkipRest is returned when Options.SkipEntry skips the rest of the directory of a file.
+var errSkipRest = errors.New("skip the rest of the directory")
+
+// isSkipErr tells whether err is fs.SkipDir or fs.SkipAll.
+func isSkipErr(err error) bool {
+	return errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll)
+}
+
 // copyFile is for just a file,
 // with considering existence of parent directory
 // and file permission.
 func copyFile(src, dest string, info os.FileInfo, opt Options) (err error) { //nolint: cyclop
-	srcFs := opt.SrcFs
 	destFs := opt.DestFs
+	key := dest
+
+	opt.transform = transformer(src, info, opt)
 
-	if err = destFs.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+	// Resume the file where a previous copy stopped, if possible.
+	f, target, offset, err := resumeFile(src, dest, opt)
+	if err != nil {
 		return err
 	}
 
-	f, err := destFs.Create(dest)
+	backup := false
+
+	if f != nil {
+		dest = target
+	} else {
+		var overwrite, skip bool
+
+		dest, overwrite, skip, err = checkFile(src, dest, info, opt)
+		if err != nil || skip {
+			return err
+		}
+
+		backup = overwrite && opt.Backup != NoBackup
+
+		// The existing file is backed up right before being replaced, to keep it in place as long as possible.
+		if backup && !opt.Atomic {
+			if err := backupFile(src, dest, false, opt); err != nil {
+				return err
+			}
+		}
+
+		if err = destFs.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+			return destError("mkdir", src, dest, err)
+		}
+
+		target = dest
+
+		if opt.Atomic {
+			f, target, err = createTempFile(destFs, dest)
+		} else {
+			f, err = destFs.Create(dest)
+		}
+
+		if err != nil {
+			return destError("create", src, dest, err)
+		}
+	}
+
+	// The offsets of a transformed file are not the ones of the source.
+	if !opt.Atomic && opt.transform == nil {
+		f = opt.checkpoint.file(src, key, target, offset, f)
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		// Do not leave a half-written file behind when the copy is canceled, or when it is atomic, unless it can be
+		// resumed.
+		if cf, ok := f.(*checkpointFile); ok {
+			err = errors.Join(err, cf.save())
+		} else if opt.Atomic || isContextError(err) {
+			ignore(destFs.Remove(target))
+		}
+	}()
+
+	written, strategy, err := writeFile(src, dest, target, info, f, offset, opt)
 	if err != nil {
 		return err
 	}
 
-	defer closeFile(f, &err)
+	if opt.Atomic {
+		// The backup is a link or a copy, the destination stays in place until the temporary file replaces it.
+		if backup {
+			if err := backupFile(src, dest, true, opt); err != nil {
+				return err
+			}
+		}
+
+		if err := destFs.Rename(target, dest); err != nil {
+			return destError("rename", src, dest, err)
+		}
+	}
+
+	opt.result.addFile(written, strategy)
+	opt.linked.copied(dest)
+
+	return nil
+}
+
+// writeFile writes the content of src to the target file, then closes it.
+// The target is either the destination or a temporary file that replaces the destination after.
+func writeFile(src, dest, target string, info os.FileInfo, f afero.File, offset int64, opt Options) (written int64, strategy CopyStrategy, err error) { //nolint: cyclop
+	srcFs := opt.SrcFs
+	destFs := opt.DestFs
+
+	defer closeFile(f, &err, func(err error) error {
+		return destError("close", src, dest, err)
+	})
 
-	chmod, err := opt.PermissionControl(info, destFs, dest)
+	chmod, err := opt.PermissionControl(info, destFs, target)
 	if err != nil {
-		return err
+		return 0, BufferedCopy, destError("chmod", src, dest, err)
+	}
+
+	if chmod(&err); err != nil {
+		return 0, BufferedCopy, destError("chmod", src, dest, err)
+	}
+
+	if opt.planning {
+		written = info.Size()
+	} else if written, strategy, err = copyFileContent(src, dest, info, f, offset, opt); err != nil {
+		return written, strategy, err
+	}
+
+	if opt.PreserveOwner {
+		if err := preserveOwner(srcFs, src, destFs, target, info); err != nil {
+			return written, strategy, destError("chown", src, dest, err)
+		}
 	}
 
-	chmod(&err)
+	if opt.PreserveTimes {
+		if err := preserveTimes(info, destFs, target); err != nil {
+			return written, strategy, destError("chtimes", src, dest, err)
+		}
+	}
+
+	return written, strategy, nil
+}
 
-	s, err := srcFs.Open(src)
+// copyFileContent copies the content of src to the destination file, from offset, and returns the number of bytes
+// written, and how.
+func copyFileContent(src, dest string, info os.FileInfo, f afero.File, offset int64, opt Options) (written int64, strategy CopyStrategy, err error) {
+	s, err := opt.SrcFs.Open(src)
 	if err != nil {
-		return err
+		return 0, BufferedCopy, srcError("open", src, dest, err)
 	}
 
-	defer closeFile(s, &err)
+	defer closeFile(s, &err, func(err error) error {
+		return srcError("close", src, dest, err)
+	})
+
+	if offset > 0 {
+		if _, err := s.Seek(offset, io.SeekStart); err != nil {
+			return 0, BufferedCopy, srcError("seek", src, dest, err)
+		}
+	}
 
 	var (
 		buf []byte
+		sr            = &sourceReader{r: s}
+		r   io.Reader = opt.progress.reader(src, dest, info, newContextReader(opt.ctx, sr))
 		w   io.Writer = f
 	)
 
@@ -114,55 +391,94 @@ func copyFile(src, dest string, info os.FileInfo, opt Options) (err error) { //n
 		w = struct{ io.Writer }{f}
 	}
 
-	if _, err = io.CopyBuffer(w, s, buf); err != nil {
-		return err
-	}
+	fast := false
 
-	if opt.Sync {
-		err = f.Sync()
+	if opt.FastCopy && opt.transform == nil {
+		written, strategy, fast, err = fastCopyContent(src, dest, info, s, r, f, offset, opt)
 	}
 
-	if opt.PreserveOwner {
-		if err := preserveOwner(srcFs, src, destFs, dest, info); err != nil {
-			return err
+	switch {
+	case fast:
+
+	case opt.transform != nil:
+		written, err = transformContent(src, dest, r, sr, f, opt)
+
+	case opt.Sparse:
+		written, err = copySparse(src, dest, info, s, r, sr, f, offset, opt)
+
+	case opt.progress == nil && buf == nil && !cancelable(opt.ctx) && osFiles(s, f):
+		// Nothing wraps the source, so that the destination can read from it in the kernel, with copy_file_range.
+		// The side of an error is not known then.
+		if written, err = io.Copy(f, s); err != nil {
+			err = &CopyError{Op: "copy", Src: src, Dest: dest, Err: err}
 		}
-	}
 
-	if opt.PreserveTimes {
-		if err := preserveTimes(info, destFs, dest); err != nil {
-			return err
+	default:
+		if written, err = io.CopyBuffer(w, r, buf); err != nil {
+			err = contentError(src, dest, sr, err)
 		}
 	}
 
-	return nil
+	if err != nil {
+		return written, strategy, err
+	}
+
+	if opt.Sync {
+		return written, strategy, destError("sync", src, dest, f.Sync())
+	}
+
+	return written, strategy, nil
 }
 
-func checkDir(srcDir, destDir string, opt Options) (exit bool, err error) {
+// osFiles tells whether the source and the destination files are both files of the operating system.
+func osFiles(s, f afero.File) bool {
+	_, sok := s.(*os.File)
+	_, fok := f.(*os.File)
+
+	return sok && fok
+}
+
+func checkDir(srcDir, destDir string, opt Options) (exit, mirror, stage bool, err error) {
 	srcFs := opt.SrcFs
 	destFs := opt.DestFs
 
 	_, err = destFs.Stat(destDir)
-	if err == nil && opt.OnDirExists != nil && destDir != opt.intent.dest {
+
+	// The destination itself is only merged, or mirrored with Options.MirrorDest.
+	if err == nil && destDir == opt.intent.dest {
+		return false, opt.MirrorDest, false, nil
+	}
+
+	if err == nil && opt.OnDirExists != nil {
 		switch opt.OnDirExists(srcFs, srcDir, destFs, destDir) {
 		case Replace:
+			if opt.StagedReplace {
+				return false, false, true, nil
+			}
+
 			if err := destFs.RemoveAll(destDir); err != nil {
-				return true, err
+				return true, false, false, destError("removeall", srcDir, destDir, err)
 			}
 
 		case Untouchable:
-			return true, nil
+			opt.result.skip(srcDir, destDir, SkippedUntouchable)
+
+			return true, false, false, nil
+
+		case Mirror:
+			return false, true, false, nil
 
 		// case "Merge" is default behavior. Go through.
 		case Merge:
-			return false, nil
+			return false, false, false, nil
 		}
 	}
 
 	if err != nil && !os.IsNotExist(err) {
-		return true, err // Unwelcome error type...!
+		return true, false, false, destError("stat", srcDir, destDir, err) // Unwelcome error type...!
 	}
 
-	return false, nil
+	return false, false, false, nil
 }
 
 // copyDir is for a directory,
@@ -172,41 +488,139 @@ func copyDir(srcDir, destDir string, info os.FileInfo, opt Options) (err error)
 	srcFs := opt.SrcFs
 	destFs := opt.DestFs
 
-	exit, err := checkDir(srcDir, destDir, opt)
+	exit, mirror, stage, err := checkDir(srcDir, destDir, opt)
 	if err != nil || exit {
 		return err
 	}
 
+	if stage {
+		return copyDirStaged(srcDir, destDir, info, opt)
+	}
+
+	defer func() {
+		if err == nil {
+			opt.result.addDir()
+		}
+	}()
+
 	chmod, err := opt.PermissionControl(info, destFs, destDir)
 	if err != nil {
-		return err
+		return destError("mkdir", srcDir, destDir, err)
 	}
 
-	defer chmod(&err)
+	defer func() {
+		var chmodErr error
+
+		if chmod(&chmodErr); err == nil {
+			err = destError("chmod", srcDir, destDir, chmodErr)
+		}
+	}()
 
 	contents, err := afero.ReadDir(srcFs, srcDir)
+	if err != nil {
+		return srcError("readdir", srcDir, destDir, err)
+	}
+
+	ignores, err := loadIgnoreFiles(srcDir, destDir, contents, opt)
 	if err != nil {
 		return err
 	}
 
+	g := newGroup(opt.ctx, opt.pool)
+
+	// The entries stop as soon as any of them fails.
+	next := opt
+	next.ctx = g.ctx
+	next.ignores = ignores
+
+	// skipRest is set when Options.SkipEntry skips the rest of the directory.
+	var skipRest atomic.Bool
+
 	for _, content := range contents {
 		cs, cd := filepath.Join(srcDir, content.Name()), filepath.Join(destDir, content.Name())
 
-		if err = copyNextOrSkip(cs, cd, content, opt); err != nil {
-			// If any error, exit immediately.
+		if skipRest.Load() || opt.stopped.Load() {
+			break
+		}
+
+		if err = checkContext(next.ctx, cs, cd); err != nil {
+			break
+		}
+
+		child := next
+		child.rel = filepath.Join(opt.rel, content.Name())
+
+		var skip bool
+
+		if cd, skip, err = destPath(cs, destDir, content, child); skip {
+			opt.result.skip(cs, cd, SkippedByCallback)
+
+			continue
+		}
+
+		if err != nil {
+			if err = child.handleError(cs, cd, err); err != nil {
+				break
+			}
+
+			continue
+		}
+
+		child.mapped = opt.mapper != nil
+
+		// Only regular files go to the worker pool, everything else may need a worker on its own.
+		g.Go(content.Mode().IsRegular(), func() error {
+			err := copyNextOrSkip(cs, cd, content, child)
+
+			switch {
+			case errors.Is(err, fs.SkipAll):
+				opt.stopped.Store(true)
+
+				return nil
+
+			case errors.Is(err, errSkipRest):
+				skipRest.Store(true)
+
+				return nil
+			}
+
+			return child.handleError(cs, cd, err)
+		})
+	}
+
+	// If any error, exit immediately.
+	if gerr := g.Wait(); gerr != nil {
+		return gerr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// The entries that are not copied yet are not extraneous.
+	// With Options.MapPath, the entries may come from anywhere, so they are only known at the end.
+	switch {
+	case !mirror || opt.stopped.Load():
+	case opt.mapper != nil:
+		opt.mapper.deferMirror(srcDir, destDir, info)
+	default:
+		keep := opt
+		keep.ignores = ignores
+
+		if err := removeExtraneous(srcDir, destDir, contents, keep); err != nil {
 			return err
 		}
 	}
 
 	if opt.PreserveOwner {
 		if err := preserveOwner(srcFs, srcDir, destFs, destDir, info); err != nil {
-			return err
+			return destError("chown", srcDir, destDir, err)
 		}
 	}
 
 	if opt.PreserveTimes {
 		if err := preserveTimes(info, destFs, destDir); err != nil {
-			return err
+			return destError("chtimes", srcDir, destDir, err)
 		}
 	}
 
@@ -216,28 +630,36 @@ func copyDir(srcDir, destDir string, info os.FileInfo, opt Options) (err error)
 func onSymlink(src, dest string, opt Options) error {
 	destFs, ok := opt.DestFs.(afero.Symlinker)
 	if !ok {
-		return afero.ErrNoSymlink
+		return destError("symlink", src, dest, afero.ErrNoSymlink)
 	}
 
 	switch opt.OnSymlink(opt.SrcFs, src) {
 	case Shallow:
-		return copySymlink(src, destFs, dest)
+		if err := copySymlink(src, destFs, dest); err != nil {
+			return err
+		}
+
+		opt.result.addSymlink()
+
+		return nil
 
 	case Deep:
 		orig, err := destFs.ReadlinkIfPossible(src)
 		if err != nil {
-			return err
+			return srcError("readlink", src, dest, err)
 		}
 
 		info, _, err := destFs.LstatIfPossible(orig)
 		if err != nil {
-			return err
+			return srcError("lstat", orig, dest, err)
 		}
 
 		return copyNextOrSkip(orig, dest, info, opt)
 
 	case Skip:
-		fallthrough
+		opt.result.skip(src, dest, SkippedSymlink)
+
+		return nil
 
 	default:
 		return nil // do nothing
@@ -247,19 +669,28 @@ func onSymlink(src, dest string, opt Options) error {
 // copySymlink is for a symlink,
 // with just creating a new symlink by replicating src symlink.
 func copySymlink(src string, destFs afero.Symlinker, dest string) error {
-	src, err := destFs.ReadlinkIfPossible(src)
+	target, err := destFs.ReadlinkIfPossible(src)
 	if err != nil {
-		return err
+		return srcError("readlink", src, dest, err)
+	}
+
+	return destError("symlink", src, dest, destFs.SymlinkIfPossible(target, dest))
+}
+
+// depth returns the depth of the entry at rel, relative to the source: 1 for the entries of the source.
+func depth(rel string) int {
+	if rel == "" {
+		return 0
 	}
 
-	return destFs.SymlinkIfPossible(src, dest)
+	return strings.Count(filepath.ToSlash(rel), "/") + 1
 }
 
 // closeFile ANYHOW closes file,
-// with assigning error raised during Close,
+// with assigning error raised during Close, wrapped,
 // BUT respecting the error already reported.
-func closeFile(f afero.File, reported *error) {
+func closeFile(f afero.File, reported *error, wrap func(error) error) {
 	if err := f.Close(); *reported == nil {
-		*reported = err
+		*reported = wrap(err)
 	}
 }
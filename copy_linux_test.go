@@ -0,0 +1,56 @@
+//go:build linux
+// +build linux
+
+package aferocopy
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readSyscalls returns the number of read syscalls of the process so far.
+func readSyscalls(t *testing.T) int64 {
+	t.Helper()
+
+	content, err := os.ReadFile("/proc/self/io")
+	require.NoError(t, err)
+
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		if v, ok := bytes.CutPrefix(line, []byte("syscr: ")); ok {
+			n, err := strconv.ParseInt(string(v), 10, 64)
+			require.NoError(t, err)
+
+			return n
+		}
+	}
+
+	t.Fatal("no syscr in /proc/self/io")
+
+	return 0
+}
+
+// The other tests do not run at the same time, so that they do not count.
+func TestCopy_KernelCopy(t *testing.T) { //nolint: paralleltest
+	dir := t.TempDir()
+	src, dest := filepath.Join(dir, "src.bin"), filepath.Join(dir, "dest.bin")
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1<<20)
+
+	require.NoError(t, os.WriteFile(src, content, 0o644))
+
+	before := readSyscalls(t)
+
+	require.NoError(t, Copy(src, dest))
+
+	// The source is not read by the process, 16 MiB would take 512 reads of 32 KiB.
+	assert.Less(t, readSyscalls(t)-before, int64(64))
+
+	actual, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, content, actual)
+}
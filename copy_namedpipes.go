@@ -5,17 +5,14 @@ package aferocopy
 
 import (
 	"os"
-	"path/filepath"
 	"syscall"
-
-	"github.com/spf13/afero"
 )
 
-// copyPipe is for just named pipes.
-func copyPipe(destFs afero.Fs, dest string, info os.FileInfo) error {
-	if err := destFs.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
-		return err
+// hostMkfifo creates a named pipe on the host.
+func hostMkfifo(name string, mode os.FileMode) error {
+	if err := syscall.Mkfifo(name, uint32(mode.Perm())); err != nil {
+		return &os.PathError{Op: "mkfifo", Path: name, Err: err}
 	}
 
-	return syscall.Mkfifo(dest, uint32(info.Mode()))
+	return nil
 }
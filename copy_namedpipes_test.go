@@ -4,14 +4,29 @@
 package aferocopy
 
 import (
+	"context"
 	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.nhat.io/aferomock"
 )
 
+// mkfifoFs is a filesystem that creates the named pipes with mkfifo.
+type mkfifoFs struct {
+	afero.Fs
+
+	mkfifo func(name string, mode os.FileMode) error
+}
+
+func (fs mkfifoFs) MkfifoIfPossible(name string, mode os.FileMode) error {
+	return fs.mkfifo(name, mode)
+}
+
 func TestCopyPipe_CouldNotMkdir(t *testing.T) {
 	t.Parallel()
 
@@ -20,9 +35,121 @@ func TestCopyPipe_CouldNotMkdir(t *testing.T) {
 			Return(errors.New("could not mkdir"))
 	})(t)
 
-	err := copyPipe(fs, "/path/to/pipe", aferomock.NopFileInfo(t))
+	destFs := mkfifoFs{Fs: fs, mkfifo: func(string, os.FileMode) error {
+		return nil
+	}}
+
+	err := copyPipe("/src/pipe", "/path/to/pipe", aferomock.NopFileInfo(t), Options{DestFs: destFs})
 
-	expectedErr := `could not mkdir`
+	expectedErr := `mkdir /src/pipe -> /path/to/pipe (destination): could not mkdir`
 
 	require.EqualError(t, err, expectedErr)
 }
+
+// newPipeFixture creates a source with a file and a named pipe.
+func newPipeFixture(t *testing.T) string {
+	t.Helper()
+
+	src := filepath.Join(t.TempDir(), "src")
+
+	require.NoError(t, os.Mkdir(src, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o644))
+
+	if err := hostMkfifo(filepath.Join(src, "pipe"), 0o640); err != nil {
+		t.Skipf("named pipes are not supported: %s", err)
+	}
+
+	return src
+}
+
+func TestOptions_OnSpecialFile(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario      string
+		action        SpecialFileAction
+		expectedErr   string
+		expectedNames []string
+		expectedMode  os.FileMode
+		skipped       bool
+	}{
+		{
+			scenario:      "skip",
+			action:        SkipSpecialFile,
+			expectedNames: []string{"a.txt"},
+			skipped:       true,
+		},
+		{
+			scenario:    "fail",
+			action:      FailSpecialFile,
+			expectedErr: "unsupported operation",
+		},
+		{
+			scenario:      "create empty file",
+			action:        CreateEmptyFile,
+			expectedNames: []string{"a.txt", "pipe"},
+			expectedMode:  0o640,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			src := newPipeFixture(t)
+			destFs := afero.NewMemMapFs()
+
+			res, err := CopyWithResult(context.Background(), src, "/dest", Options{
+				SrcFs:  afero.NewOsFs(),
+				DestFs: destFs,
+				OnSpecialFile: func(_ afero.Fs, src string, info os.FileInfo) SpecialFileAction {
+					assert.Equal(t, "pipe", filepath.Base(src))
+					assert.NotZero(t, info.Mode()&os.ModeNamedPipe)
+
+					return tc.action
+				},
+			})
+
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedNames, dirNames(t, destFs, "/dest"))
+			assert.Zero(t, res.Pipes)
+
+			if tc.skipped {
+				assert.Equal(t, []SkippedEntry{{
+					Src:    filepath.Join(src, "pipe"),
+					Dest:   "/dest/pipe",
+					Reason: SkippedSpecialFile,
+				}}, res.Skipped)
+			} else {
+				info, err := destFs.Stat("/dest/pipe")
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedMode, info.Mode())
+				assert.Zero(t, info.Size())
+			}
+		})
+	}
+}
+
+func TestCopyPipe_BasePathFs(t *testing.T) {
+	t.Parallel()
+
+	src := newPipeFixture(t)
+	dir := t.TempDir()
+
+	res, err := CopyWithResult(context.Background(), src, "/dest", Options{
+		SrcFs:  afero.NewOsFs(),
+		DestFs: NewBasePathFs(afero.NewOsFs(), dir),
+	})
+	require.NoError(t, err)
+
+	info, err := os.Lstat(filepath.Join(dir, "dest", "pipe"))
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeNamedPipe)
+	assert.Equal(t, int64(1), res.Pipes)
+}
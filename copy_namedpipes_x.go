@@ -4,12 +4,11 @@
 package aferocopy
 
 import (
+	"errors"
 	"os"
-
-	"github.com/spf13/afero"
 )
 
-// copyPipe is for just named pipes. Windows doesn't support them.
-func copyPipe(destFs afero.Fs, dest string, info os.FileInfo) error {
-	return nil
+// hostMkfifo is not supported.
+func hostMkfifo(name string, _ os.FileMode) error {
+	return &os.PathError{Op: "mkfifo", Path: name, Err: errors.ErrUnsupported}
 }
@@ -0,0 +1,89 @@
+package aferocopy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// Mknoder is implemented by the filesystems that can create device nodes. afero.OsFs can without it.
+// The mode tells whether the device is a character or a block device, and dev is its number, as the source tells.
+// It returns an error matching errors.ErrUnsupported when it cannot.
+type Mknoder interface {
+	MknodIfPossible(name string, mode os.FileMode, dev uint64) error
+}
+
+// mknod creates a device node with the filesystem, if it can.
+func mknod(fs afero.Fs, name string, mode os.FileMode, dev uint64) error {
+	switch fs := fs.(type) {
+	case Mknoder:
+		return fs.MknodIfPossible(name, mode, dev)
+
+	case *afero.OsFs:
+		return hostMknod(name, mode, dev)
+	}
+
+	return &os.PathError{Op: "mknod", Path: name, Err: errors.ErrUnsupported}
+}
+
+// canMknod tells whether the filesystem may create device nodes.
+func canMknod(fs afero.Fs) bool {
+	switch fs.(type) {
+	case Mknoder, *afero.OsFs:
+		return true
+	}
+
+	return false
+}
+
+// copyDevice is for just device nodes. They are recreated with the same device number, never read.
+func copyDevice(src, dest string, info os.FileInfo, opt Options) error {
+	destFs := opt.DestFs
+
+	dev, ok := fileDevice(info)
+	if !ok || !canMknod(destFs) {
+		return onSpecialFile("mknod", src, dest, info, opt)
+	}
+
+	if err := destFs.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return destError("mkdir", src, dest, err)
+	}
+
+	// Creating a device node usually needs privileges.
+	err := mknod(destFs, dest, info.Mode(), dev)
+	if errors.Is(err, errors.ErrUnsupported) || errors.Is(err, os.ErrPermission) {
+		return onSpecialFile("mknod", src, dest, info, opt)
+	}
+
+	if err != nil {
+		return destError("mknod", src, dest, err)
+	}
+
+	// The device node is created with the umask, like any file.
+	chmod, err := opt.PermissionControl(info, destFs, dest)
+	if err != nil {
+		return destError("chmod", src, dest, err)
+	}
+
+	if chmod(&err); err != nil {
+		return destError("chmod", src, dest, err)
+	}
+
+	if opt.PreserveOwner {
+		if err := preserveOwner(opt.SrcFs, src, destFs, dest, info); err != nil {
+			return destError("chown", src, dest, err)
+		}
+	}
+
+	if opt.PreserveTimes {
+		if err := preserveTimes(info, destFs, dest); err != nil {
+			return destError("chtimes", src, dest, err)
+		}
+	}
+
+	opt.result.addDevice()
+
+	return nil
+}
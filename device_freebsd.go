@@ -0,0 +1,6 @@
+package aferocopy
+
+// deviceNumber is the device number as syscall.Mknod takes it.
+func deviceNumber(dev uint64) uint64 {
+	return dev
+}
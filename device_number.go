@@ -0,0 +1,9 @@
+//go:build !windows && !plan9 && !netbsd && !aix && !illumos && !solaris && !js && !freebsd
+// +build !windows,!plan9,!netbsd,!aix,!illumos,!solaris,!js,!freebsd
+
+package aferocopy
+
+// deviceNumber is the device number as syscall.Mknod takes it.
+func deviceNumber(dev uint64) int {
+	return int(dev)
+}
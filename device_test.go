@@ -0,0 +1,190 @@
+//go:build !windows && !plan9 && !netbsd && !aix && !illumos && !solaris && !js
+// +build !windows,!plan9,!netbsd,!aix,!illumos,!solaris,!js
+
+package aferocopy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mknodFs is a filesystem that creates the device nodes with mknod.
+type mknodFs struct {
+	afero.Fs
+
+	mknod func(name string, mode os.FileMode, dev uint64) error
+}
+
+func (fs mknodFs) MknodIfPossible(name string, mode os.FileMode, dev uint64) error {
+	return fs.mknod(name, mode, dev)
+}
+
+// zeroDevice returns the info of the character device /dev/zero, that never ends if it is read.
+func zeroDevice(t *testing.T) os.FileInfo {
+	t.Helper()
+
+	info, err := os.Lstat("/dev/zero")
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		t.Skip("/dev/zero is not a character device")
+	}
+
+	return info
+}
+
+func TestCopyDevice(t *testing.T) {
+	t.Parallel()
+
+	if os.Geteuid() != 0 {
+		t.Skip("device nodes can only be created by root")
+	}
+
+	info := zeroDevice(t)
+	dest := filepath.Join(t.TempDir(), "zero")
+
+	res, err := CopyWithResult(context.Background(), "/dev/zero", dest, Options{})
+	require.NoError(t, err)
+
+	copied, err := os.Lstat(dest)
+	require.NoError(t, err)
+
+	expected, _ := fileDevice(info)
+	dev, ok := fileDevice(copied)
+
+	assert.True(t, ok)
+	assert.Equal(t, expected, dev)
+	assert.Equal(t, info.Mode(), copied.Mode())
+	assert.Equal(t, int64(1), res.Devices)
+}
+
+func TestCopyDevice_CannotMknod(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario      string
+		destFs        func() afero.Fs
+		action        SpecialFileAction
+		expectedErr   string
+		expectedNames []string
+	}{
+		{
+			scenario:      "skip",
+			destFs:        afero.NewMemMapFs,
+			action:        SkipSpecialFile,
+			expectedNames: []string{},
+		},
+		{
+			scenario:    "fail",
+			destFs:      afero.NewMemMapFs,
+			action:      FailSpecialFile,
+			expectedErr: "mknod /dev/zero -> /dest/zero (destination): unsupported operation",
+		},
+		{
+			scenario:      "create empty file",
+			destFs:        afero.NewMemMapFs,
+			action:        CreateEmptyFile,
+			expectedNames: []string{"zero"},
+		},
+		{
+			scenario: "not permitted",
+			destFs: func() afero.Fs {
+				return mknodFs{Fs: afero.NewMemMapFs(), mknod: func(name string, _ os.FileMode, _ uint64) error {
+					return &os.PathError{Op: "mknod", Path: name, Err: os.ErrPermission}
+				}}
+			},
+			action:        SkipSpecialFile,
+			expectedNames: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			zeroDevice(t)
+
+			destFs := tc.destFs()
+			require.NoError(t, destFs.Mkdir("/dest", 0o755))
+
+			res, err := CopyWithResult(context.Background(), "/dev/zero", "/dest/zero", Options{
+				SrcFs:  afero.NewOsFs(),
+				DestFs: destFs,
+				OnSpecialFile: func(_ afero.Fs, src string, info os.FileInfo) SpecialFileAction {
+					assert.Equal(t, "/dev/zero", src)
+					assert.NotZero(t, info.Mode()&os.ModeCharDevice)
+
+					return tc.action
+				},
+			})
+
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedNames, dirNames(t, destFs, "/dest"))
+			assert.Zero(t, res.Devices)
+		})
+	}
+}
+
+func TestCopyDevice_Plan(t *testing.T) {
+	t.Parallel()
+
+	info := zeroDevice(t)
+	dev, _ := fileDevice(info)
+
+	ops, err := Plan("/dev/zero", "/dest/zero", Options{
+		SrcFs:  afero.NewOsFs(),
+		DestFs: NewBasePathFs(afero.NewOsFs(), t.TempDir()),
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, ops, Operation{Type: OpMknod, Path: "/dest/zero", Mode: info.Mode(), Dev: dev})
+}
+
+func TestCopySocket(t *testing.T) {
+	t.Parallel()
+
+	src := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.Mkdir(src, 0o755))
+
+	l, err := net.Listen("unix", filepath.Join(src, "sock"))
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %s", err)
+	}
+
+	t.Cleanup(func() {
+		_ = l.Close() //nolint: errcheck
+	})
+
+	dest := filepath.Join(t.TempDir(), "dest")
+
+	res, err := CopyWithResult(context.Background(), src, dest, Options{})
+	require.NoError(t, err)
+
+	_, err = os.Lstat(filepath.Join(dest, "sock"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	assert.Equal(t, []SkippedEntry{{
+		Src:    filepath.Join(src, "sock"),
+		Dest:   filepath.Join(dest, "sock"),
+		Reason: SkippedSpecialFile,
+	}}, res.Skipped)
+
+	err = Copy(src, filepath.Join(t.TempDir(), "dest"), Options{
+		OnSpecialFile: func(afero.Fs, string, os.FileInfo) SpecialFileAction {
+			return FailSpecialFile
+		},
+	})
+	require.ErrorIs(t, err, errors.ErrUnsupported)
+}
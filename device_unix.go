@@ -0,0 +1,34 @@
+//go:build !windows && !plan9 && !netbsd && !aix && !illumos && !solaris && !js
+// +build !windows,!plan9,!netbsd,!aix,!illumos,!solaris,!js
+
+package aferocopy
+
+import (
+	"os"
+	"syscall"
+)
+
+// hostMknod creates a device node on the host.
+func hostMknod(name string, mode os.FileMode, dev uint64) error {
+	typ := uint32(syscall.S_IFBLK)
+
+	if mode&os.ModeCharDevice != 0 {
+		typ = syscall.S_IFCHR
+	}
+
+	if err := syscall.Mknod(name, typ|uint32(mode.Perm()), deviceNumber(dev)); err != nil {
+		return &os.PathError{Op: "mknod", Path: name, Err: err}
+	}
+
+	return nil
+}
+
+// fileDevice returns the device number of the device node.
+func fileDevice(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || info.Mode()&os.ModeDevice == 0 {
+		return 0, false
+	}
+
+	return uint64(stat.Rdev), true //nolint: unconvert
+}
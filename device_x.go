@@ -0,0 +1,19 @@
+//go:build windows || plan9 || netbsd || aix || illumos || solaris || js
+// +build windows plan9 netbsd aix illumos solaris js
+
+package aferocopy
+
+import (
+	"errors"
+	"os"
+)
+
+// hostMknod is not supported.
+func hostMknod(name string, _ os.FileMode, _ uint64) error {
+	return &os.PathError{Op: "mknod", Path: name, Err: errors.ErrUnsupported}
+}
+
+// fileDevice is not supported.
+func fileDevice(os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,268 @@
+package aferocopy
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// Side tells on which filesystem an operation failed.
+type Side int
+
+const (
+	// NoSide means the failure is not on a filesystem, for example, when the copy is canceled.
+	NoSide Side = iota
+	// SrcSide means the failure is on the source filesystem.
+	SrcSide
+	// DestSide means the failure is on the destination filesystem.
+	DestSide
+)
+
+// String returns the name of the side.
+func (s Side) String() string {
+	switch s {
+	case SrcSide:
+		return "source"
+
+	case DestSide:
+		return "destination"
+
+	default:
+		return ""
+	}
+}
+
+// CopyError is the error of copying an entry.
+//
+// All the failures of the filesystems are returned as a CopyError, while the errors returned by the callbacks, such
+// as Options.Skip, are returned as they are.
+type CopyError struct {
+	// Op is the operation that failed, such as open, create, read, write, mkdir, chmod, chown, chtimes, readlink,
+	// symlink, mkfifo or mknod. It is "copy" when the copy is canceled, or when the content is copied in the kernel
+	// between two files of the operating system, where the failing side is not known, with NoSide.
+	Op string
+
+	// Src and Dest are the paths of the entry being copied.
+	Src  string
+	Dest string
+
+	// Fs tells on which filesystem the operation failed.
+	Fs Side
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the error message.
+func (e *CopyError) Error() string {
+	msg := e.Op + " " + e.Src + " -> " + e.Dest
+
+	if e.Fs != NoSide {
+		msg += " (" + e.Fs.String() + ")"
+	}
+
+	return msg + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *CopyError) Unwrap() error {
+	return e.Err
+}
+
+// newCopyError wraps err in a CopyError, unless it is already one.
+func newCopyError(op, src, dest string, err error) *CopyError {
+	var copyErr *CopyError
+
+	if errors.As(err, &copyErr) {
+		return copyErr
+	}
+
+	var (
+		pathErr *os.PathError
+		linkErr *os.LinkError
+	)
+
+	switch {
+	case errors.As(err, &pathErr):
+		op = pathErr.Op
+
+	case errors.As(err, &linkErr):
+		op = linkErr.Op
+	}
+
+	return &CopyError{Op: op, Src: src, Dest: dest, Err: err}
+}
+
+// srcError wraps the error of an operation on the source filesystem, unless it is nil or already a CopyError.
+func srcError(op, src, dest string, err error) error {
+	return wrapError(op, SrcSide, src, dest, err)
+}
+
+// destError wraps the error of an operation on the destination filesystem, unless it is nil or already a CopyError.
+func destError(op, src, dest string, err error) error {
+	return wrapError(op, DestSide, src, dest, err)
+}
+
+func wrapError(op string, side Side, src, dest string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var copyErr *CopyError
+
+	if errors.As(err, &copyErr) {
+		return err
+	}
+
+	return &CopyError{Op: op, Src: src, Dest: dest, Fs: side, Err: err}
+}
+
+// sourceReader remembers the error of reading the source,
+// so that it is not mistaken for an error of writing the destination.
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *sourceReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.err = err
+	}
+
+	return n, err
+}
+
+// contentError wraps the error of copying the content of src, read with sr, to dest.
+func contentError(src, dest string, sr *sourceReader, err error) error {
+	switch {
+	case isContextError(err):
+		return &CopyError{Op: "copy", Src: src, Dest: dest, Err: err}
+
+	case sr.err != nil && errors.Is(err, sr.err):
+		return srcError("read", src, dest, err)
+
+	default:
+		return destError("write", src, dest, err)
+	}
+}
+
+// ErrorAction represents what to do when an entry fails to be copied.
+type ErrorAction int
+
+const (
+	// Abort stops the copy and returns the error (default behavior).
+	Abort ErrorAction = iota
+	// Continue skips the entry and goes on with the others.
+	// All the errors are joined and returned at the end of the copy.
+	Continue
+)
+
+// abortedError is an error that Options.OnError decided to abort on,
+// so that it is not decided again by the parent directories.
+type abortedError struct {
+	err error
+}
+
+func (e *abortedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *abortedError) Unwrap() error {
+	return e.err
+}
+
+// errorCollector collects the errors to continue on, it is safe for concurrent use.
+type errorCollector struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (c *errorCollector) add(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.errs = append(c.errs, err)
+}
+
+// empty tells whether no error is collected. A nil collector is empty.
+func (c *errorCollector) empty() bool {
+	if c == nil {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.errs) == 0
+}
+
+// join joins the collected errors and the given one.
+func (c *errorCollector) join(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.errs) == 0 {
+		return err
+	}
+
+	return errors.Join(append(c.errs, err)...)
+}
+
+// handleError decides what to do with the error of copying src to dest, following Options.OnError.
+// It returns nil if the copy should continue.
+func (o Options) handleError(src, dest string, err error) error {
+	if err == nil || o.OnError == nil || isContextError(err) {
+		return err
+	}
+
+	var aborted *abortedError
+
+	if errors.As(err, &aborted) {
+		return err
+	}
+
+	copyErr := newCopyError("copy", src, dest, err)
+
+	if o.OnError(copyErr) != Continue {
+		return &abortedError{err: err}
+	}
+
+	o.failures.add(copyErr)
+
+	return nil
+}
+
+// walk copies src to dest and deals with the errors following Options.OnError.
+func walk(src, dest string, info os.FileInfo, opt Options) error {
+	opt.failures = &errorCollector{}
+
+	return opt.failures.join(walkOrAbort(src, dest, info, opt))
+}
+
+// walkOrAbort copies src to dest and returns the error the copy is aborted with, if any.
+// The errors to continue on are collected in Options.failures.
+func walkOrAbort(src, dest string, info os.FileInfo, opt Options) error {
+	err := switchboard(src, dest, info, opt)
+
+	// The source itself is skipped, when it is a symlink to follow.
+	if errors.Is(err, errSkipRest) || errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+
+	if err == nil && !opt.stopped.Load() {
+		err = opt.mapper.mirror(opt)
+	}
+
+	err = opt.handleError(src, dest, err)
+
+	var aborted *abortedError
+
+	if errors.As(err, &aborted) {
+		return aborted.err
+	}
+
+	return err
+}
@@ -0,0 +1,239 @@
+package aferocopy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFailingFixtureFs returns a source where a.txt and dir/b.txt cannot be opened.
+func newFailingFixtureFs(t *testing.T) afero.Fs {
+	t.Helper()
+
+	fs := newFixtureFs(t, map[string]string{
+		"/src/a.txt":     "a",
+		"/src/dir/b.txt": "b",
+		"/src/dir/c.txt": "c",
+		"/src/z.txt":     "z",
+	})
+
+	return &failingOpenFs{Fs: fs, errs: map[string]error{
+		"/src/a.txt":     &os.PathError{Op: "open", Path: "/src/a.txt", Err: os.ErrPermission},
+		"/src/dir/b.txt": &os.PathError{Op: "open", Path: "/src/dir/b.txt", Err: os.ErrPermission},
+	}}
+}
+
+func TestOptions_OnError_Continue(t *testing.T) {
+	t.Parallel()
+
+	destFs := afero.NewMemMapFs()
+
+	var decided []string
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:  newFailingFixtureFs(t),
+		DestFs: destFs,
+		OnError: func(err *CopyError) ErrorAction {
+			decided = append(decided, err.Src)
+
+			return Continue
+		},
+	})
+	require.Error(t, err)
+	require.ErrorIs(t, err, os.ErrPermission)
+
+	assert.Equal(t, []string{"/src/a.txt", "/src/dir/b.txt"}, decided)
+
+	var joined interface{ Unwrap() []error }
+
+	require.ErrorAs(t, err, &joined)
+
+	errs := joined.Unwrap()
+
+	require.Len(t, errs, 2)
+
+	expected := []*CopyError{
+		{Op: "open", Src: "/src/a.txt", Dest: "/dest/a.txt", Fs: SrcSide, Err: &os.PathError{Op: "open", Path: "/src/a.txt", Err: os.ErrPermission}},
+		{Op: "open", Src: "/src/dir/b.txt", Dest: "/dest/dir/b.txt", Fs: SrcSide, Err: &os.PathError{Op: "open", Path: "/src/dir/b.txt", Err: os.ErrPermission}},
+	}
+
+	for i, err := range errs {
+		var copyErr *CopyError
+
+		require.ErrorAs(t, err, &copyErr)
+		assert.Equal(t, expected[i], copyErr)
+	}
+
+	for _, name := range []string{"/dest/dir/c.txt", "/dest/z.txt"} {
+		_, err := destFs.Stat(name)
+		require.NoError(t, err, name)
+	}
+}
+
+func TestOptions_OnError_Abort(t *testing.T) {
+	t.Parallel()
+
+	destFs := afero.NewMemMapFs()
+	calls := 0
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:  newFailingFixtureFs(t),
+		DestFs: destFs,
+		OnError: func(err *CopyError) ErrorAction {
+			calls++
+
+			if err.Src == "/src/a.txt" {
+				return Continue
+			}
+
+			return Abort
+		},
+	})
+
+	// The error is returned as is, along with the ones to continue on.
+	require.ErrorIs(t, err, os.ErrPermission)
+	assert.Equal(t, 2, calls, "the error must be decided only once")
+	assert.Equal(t, "open /src/a.txt -> /dest/a.txt (source): open /src/a.txt: permission denied\n"+
+		"open /src/dir/b.txt -> /dest/dir/b.txt (source): open /src/dir/b.txt: permission denied", err.Error())
+
+	_, err = destFs.Stat("/dest/z.txt")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOptions_OnError_NotSet(t *testing.T) {
+	t.Parallel()
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:  newFailingFixtureFs(t),
+		DestFs: afero.NewMemMapFs(),
+	})
+
+	expected := &CopyError{
+		Op:   "open",
+		Src:  "/src/a.txt",
+		Dest: "/dest/a.txt",
+		Fs:   SrcSide,
+		Err:  &os.PathError{Op: "open", Path: "/src/a.txt", Err: os.ErrPermission},
+	}
+
+	assert.Equal(t, expected, err)
+}
+
+func TestOptions_OnError_ContextCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("a"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/b.txt", []byte("b"), 0o644))
+
+	calls := 0
+
+	err := CopyContext(ctx, "/src", "/dest", Options{
+		SrcFs:  &cancelFs{Fs: fs, cancel: cancel},
+		DestFs: afero.NewMemMapFs(),
+		OnError: func(*CopyError) ErrorAction {
+			calls++
+
+			return Continue
+		},
+	})
+
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, calls)
+}
+
+func TestCopyError(t *testing.T) {
+	t.Parallel()
+
+	err := newCopyError("copy", "src", "dest", errors.New("error"))
+
+	assert.EqualError(t, err, "copy src -> dest: error")
+	assert.Same(t, err, newCopyError("open", "foo", "bar", err))
+
+	wrapped := srcError("read", "src", "dest", errors.New("error"))
+
+	assert.EqualError(t, wrapped, "read src -> dest (source): error")
+	assert.Same(t, wrapped, destError("write", "src", "dest", wrapped))
+	require.NoError(t, destError("write", "src", "dest", nil))
+}
+
+func TestCopyError_Sides(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario   string
+		srcFs      afero.Fs
+		destFs     afero.Fs
+		expectedOp string
+		expected   Side
+	}{
+		{
+			scenario:   "read",
+			srcFs:      &failingReadFs{Fs: newFailingFixtureFs(t)},
+			destFs:     afero.NewMemMapFs(),
+			expectedOp: "read",
+			expected:   SrcSide,
+		},
+		{
+			scenario:   "lstat",
+			srcFs:      afero.NewMemMapFs(),
+			destFs:     afero.NewMemMapFs(),
+			expectedOp: "lstat",
+			expected:   SrcSide,
+		},
+		{
+			scenario:   "mkdir",
+			srcFs:      newFailingFixtureFs(t),
+			destFs:     afero.NewReadOnlyFs(afero.NewMemMapFs()),
+			expectedOp: "mkdir",
+			expected:   DestSide,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			err := Copy("/src/z.txt", "/dest/z.txt", Options{SrcFs: tc.srcFs, DestFs: tc.destFs})
+
+			var copyErr *CopyError
+
+			require.ErrorAs(t, err, &copyErr)
+			assert.Equal(t, tc.expectedOp, copyErr.Op)
+			assert.Equal(t, tc.expected, copyErr.Fs)
+			assert.Equal(t, "/src/z.txt", copyErr.Src)
+			assert.Equal(t, "/dest/z.txt", copyErr.Dest)
+		})
+	}
+}
+
+// failingReadFs fails to read the files opened from it.
+type failingReadFs struct {
+	afero.Fs
+}
+
+func (fs *failingReadFs) Open(name string) (afero.File, error) {
+	f, err := fs.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failingReadFile{File: f}, nil
+}
+
+type failingReadFile struct {
+	afero.File
+}
+
+func (f *failingReadFile) Read([]byte) (int, error) {
+	return 0, errors.New("could not read")
+}
@@ -0,0 +1,134 @@
+package aferocopy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// CopyStrategy is how the content of a file is copied.
+type CopyStrategy int
+
+const (
+	// BufferedCopy copies the content through a buffer (default behavior).
+	BufferedCopy CopyStrategy = iota
+	// CopyFileRange copies the content in the kernel, with copy_file_range.
+	CopyFileRange
+	// Reflink shares the content with the source, on the filesystems that support copy on write.
+	Reflink
+)
+
+var copyStrategies = map[CopyStrategy]string{
+	BufferedCopy:  "buffered",
+	CopyFileRange: "copy_file_range",
+	Reflink:       "reflink",
+}
+
+// String returns the name of the strategy.
+func (s CopyStrategy) String() string {
+	if name, ok := copyStrategies[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("CopyStrategy(%d)", int(s))
+}
+
+// fastCopyChunkSize is how many bytes copy_file_range copies at most at once, so that the progress is reported and
+// the context is checked in between.
+const fastCopyChunkSize = 8 << 20
+
+// hostFile returns the file of the host under f, if any.
+func hostFile(f afero.File) (*os.File, bool) {
+	for {
+		switch file := f.(type) {
+		case *os.File:
+			return file, true
+
+		case *afero.BasePathFile:
+			f = file.File
+
+		case *checkpointFile:
+			f = file.File
+
+		default:
+			return nil, false
+		}
+	}
+}
+
+// fastCopyContent copies the source, opened as s and read through r, to f from offset in the kernel, with
+// Options.FastCopy. It copies nothing and returns false when it cannot.
+func fastCopyContent(src, dest string, info os.FileInfo, s afero.File, r io.Reader, f afero.File, offset int64, opt Options) (int64, CopyStrategy, bool, error) {
+	sf, ok := hostFile(s)
+	if !ok {
+		return 0, BufferedCopy, false, nil
+	}
+
+	df, ok := hostFile(f)
+	if !ok {
+		return 0, BufferedCopy, false, nil
+	}
+
+	// A reflink replaces the whole content of the destination.
+	if offset == 0 && reflink(df, sf) == nil {
+		written, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return written, Reflink, true, destError("seek", src, dest, err)
+		}
+
+		setProgressStrategy(r, Reflink)
+		skipProgress(r, written)
+
+		return written, Reflink, true, nil
+	}
+
+	// The holes would be written.
+	if opt.Sparse || info.Size() == 0 {
+		return 0, BufferedCopy, false, nil
+	}
+
+	setProgressStrategy(r, CopyFileRange)
+
+	var written int64
+
+	for {
+		if err := checkContext(opt.ctx, src, dest); err != nil {
+			return written, CopyFileRange, true, err
+		}
+
+		n, err := copyFileRange(df, sf, fastCopyChunkSize)
+
+		switch {
+		// Some filesystems copy nothing, instead of failing.
+		case written == 0 && (errors.Is(err, errors.ErrUnsupported) || (err == nil && n == 0)):
+			setProgressStrategy(r, BufferedCopy)
+
+			return 0, BufferedCopy, false, nil
+
+		case err != nil:
+			return written, CopyFileRange, true, &CopyError{Op: "copy", Src: src, Dest: dest, Err: err}
+
+		case n == 0:
+			// The destination is written through f, when it is a checkpointFile.
+			if _, err := f.Seek(0, io.SeekCurrent); err != nil {
+				return written, CopyFileRange, true, destError("seek", src, dest, err)
+			}
+
+			return written, CopyFileRange, true, nil
+		}
+
+		written += n
+
+		skipProgress(r, n)
+	}
+}
+
+// setProgressStrategy sets the strategy the progress of r is reported with.
+func setProgressStrategy(r io.Reader, strategy CopyStrategy) {
+	if r, ok := r.(*progressReader); ok {
+		r.strategy = strategy
+	}
+}
@@ -0,0 +1,78 @@
+//go:build linux
+// +build linux
+
+package aferocopy
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink makes dst share the content of src, if the filesystem supports it.
+func reflink(dst, src *os.File) error {
+	return control(dst, src, func(dfd, sfd uintptr) error {
+		return unix.IoctlFileClone(int(dfd), int(sfd))
+	})
+}
+
+// copyFileRange copies at most size bytes from src to dst, from where they are, in the kernel. It returns
+// errors.ErrUnsupported when they cannot be copied this way.
+func copyFileRange(dst, src *os.File, size int) (int64, error) {
+	var n int
+
+	err := control(dst, src, func(dfd, sfd uintptr) error {
+		var err error
+
+		for {
+			n, err = unix.CopyFileRange(int(sfd), nil, int(dfd), nil, size, 0)
+			if !errors.Is(err, unix.EINTR) {
+				break
+			}
+		}
+
+		switch {
+		case err == nil:
+			return nil
+
+		case errors.Is(err, unix.ENOSYS), errors.Is(err, unix.EXDEV), errors.Is(err, unix.EINVAL),
+			errors.Is(err, unix.EOPNOTSUPP), errors.Is(err, unix.EPERM), errors.Is(err, unix.EBADF):
+			return errors.ErrUnsupported
+
+		default:
+			return err
+		}
+	})
+
+	return int64(n), err
+}
+
+// control runs f with the file descriptors of dst and src.
+func control(dst, src *os.File, f func(dfd, sfd uintptr) error) error {
+	dc, err := dst.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	sc, err := src.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var ferr error
+
+	err = dc.Control(func(dfd uintptr) {
+		err := sc.Control(func(sfd uintptr) {
+			ferr = f(dfd, sfd)
+		})
+		if err != nil {
+			ferr = err
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return ferr
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package aferocopy
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink is only supported on linux.
+func reflink(_, _ *os.File) error {
+	return errors.ErrUnsupported
+}
+
+// copyFileRange is only supported on linux.
+func copyFileRange(_, _ *os.File, _ int) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
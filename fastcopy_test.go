@@ -0,0 +1,159 @@
+package aferocopy
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyStrategy_String(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "buffered", BufferedCopy.String())
+	assert.Equal(t, "copy_file_range", CopyFileRange.String())
+	assert.Equal(t, "reflink", Reflink.String())
+	assert.Equal(t, "CopyStrategy(42)", CopyStrategy(42).String())
+}
+
+// kernelCopySupported tells whether the filesystem of dir can copy a file with a reflink or copy_file_range.
+func kernelCopySupported(t *testing.T, dir string) bool {
+	t.Helper()
+
+	src, err := os.CreateTemp(dir, "probe")
+	require.NoError(t, err)
+
+	defer src.Close() //nolint: errcheck
+
+	dst, err := os.CreateTemp(dir, "probe")
+	require.NoError(t, err)
+
+	defer dst.Close() //nolint: errcheck
+
+	_, err = src.WriteString("probe")
+	require.NoError(t, err)
+
+	_, err = src.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+
+	if reflink(dst, src) == nil {
+		return true
+	}
+
+	n, err := copyFileRange(dst, src, 5)
+
+	return err == nil && n > 0
+}
+
+func TestOptions_FastCopy(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	content := strings.Repeat("fast copy\n", 100_000)
+	supported := kernelCopySupported(t, dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src", "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "a.txt"), []byte(content), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "sub", "b.txt"), []byte("b"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "empty.txt"), nil, 0o644))
+
+	testCases := []struct {
+		scenario string
+		srcFs    afero.Fs
+		destFs   afero.Fs
+		src      string
+		dest     string
+		fast     bool
+	}{
+		{
+			scenario: "os",
+			srcFs:    afero.NewOsFs(),
+			destFs:   afero.NewOsFs(),
+			src:      filepath.Join(dir, "src"),
+			dest:     filepath.Join(dir, "os"),
+			fast:     true,
+		},
+		{
+			scenario: "base path",
+			srcFs:    afero.NewBasePathFs(afero.NewOsFs(), dir),
+			destFs:   afero.NewBasePathFs(afero.NewOsFs(), dir),
+			src:      "/src",
+			dest:     "/base",
+			fast:     true,
+		},
+		{
+			scenario: "memory",
+			srcFs:    afero.NewOsFs(),
+			destFs:   afero.NewMemMapFs(),
+			src:      filepath.Join(dir, "src"),
+			dest:     "/mem",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				strategies = make(map[string]CopyStrategy)
+				bytes      = make(map[string]int64)
+			)
+
+			res, err := CopyWithResult(context.Background(), tc.src, tc.dest, Options{
+				SrcFs:          tc.srcFs,
+				DestFs:         tc.destFs,
+				FastCopy:       true,
+				CopyBufferSize: 1024,
+				OnProgress: func(p Progress) {
+					if p.Event == BytesCopied {
+						strategies[filepath.Base(p.Src)] = p.Strategy
+						bytes[filepath.Base(p.Src)] = p.Bytes
+					}
+				},
+			})
+			require.NoError(t, err)
+
+			actual, err := afero.ReadFile(tc.destFs, filepath.Join(tc.dest, "a.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, content, string(actual))
+
+			actual, err = afero.ReadFile(tc.destFs, filepath.Join(tc.dest, "sub", "b.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "b", string(actual))
+
+			assert.Equal(t, int64(len(content)+1), res.Bytes)
+			assert.Equal(t, int64(len(content)), bytes["a.txt"])
+
+			var total int64
+
+			for strategy, n := range res.Strategies {
+				total += n
+
+				if !tc.fast {
+					assert.Equal(t, BufferedCopy, strategy)
+				}
+			}
+
+			assert.Equal(t, int64(3), total)
+
+			if !tc.fast {
+				assert.Equal(t, BufferedCopy, strategies["a.txt"])
+
+				return
+			}
+
+			// Which one depends on the filesystem of the temporary directory.
+			if !supported {
+				t.Skip("the filesystem of the temporary directory supports neither reflinks nor copy_file_range")
+			}
+
+			assert.Contains(t, []CopyStrategy{CopyFileRange, Reflink}, strategies["a.txt"])
+		})
+	}
+}
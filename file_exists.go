@@ -0,0 +1,120 @@
+package aferocopy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// FileExistsAction represents what to do when there is a file already existing in destination.
+type FileExistsAction int
+
+const (
+	// Overwrite truncates the existing file and copies the source over it (default behavior).
+	Overwrite FileExistsAction = iota
+	// KeepExisting does nothing for the file, and leaves it as it is.
+	KeepExisting
+	// OverwriteIfNewer overwrites the existing file only if the source is newer, and leaves it as it is otherwise.
+	OverwriteIfNewer
+	// FailIfExists fails to copy the file, with an error that wraps os.ErrExist.
+	FailIfExists
+	// KeepBoth leaves the existing file as it is, and copies the source next to it, with a name like "name (1).ext".
+	KeepBoth
+)
+
+const maxKeepBothAttempts = 10000
+
+// checkFile decides what to do with the destination of a file, when it already exists,
+// following Options.Update and Options.OnFileExists.
+// It returns the path to copy the file to, whether an existing file is overwritten there, or skip if the file should
+// not be copied.
+func checkFile(src, dest string, info os.FileInfo, opt Options) (target string, overwrite, skip bool, err error) { //nolint: cyclop
+	if opt.Update == UpdateAll && opt.OnFileExists == nil && opt.Backup == NoBackup {
+		return dest, false, false, nil
+	}
+
+	destInfo, err := stat(opt.DestFs, dest)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dest, false, false, nil
+		}
+
+		return "", false, false, destError("stat", src, dest, err)
+	}
+
+	// Let the copy fail as usual.
+	if destInfo.IsDir() {
+		return dest, false, false, nil
+	}
+
+	upToDate, err := isUpToDate(src, dest, info, destInfo, opt)
+	if err != nil {
+		return "", false, false, err
+	}
+
+	if upToDate {
+		opt.result.skip(src, dest, SkippedUpToDate)
+
+		return "", false, true, nil
+	}
+
+	if opt.OnFileExists == nil {
+		return dest, true, false, nil
+	}
+
+	switch opt.OnFileExists(opt.SrcFs, src, info, opt.DestFs, dest, destInfo) {
+	case KeepExisting:
+		opt.result.skip(src, dest, SkippedExisting)
+
+		return "", false, true, nil
+
+	case OverwriteIfNewer:
+		if !info.ModTime().After(destInfo.ModTime()) {
+			opt.result.skip(src, dest, SkippedExisting)
+
+			return "", false, true, nil
+		}
+
+	case FailIfExists:
+		return "", false, false, destError("create", src, dest, os.ErrExist)
+
+	case KeepBoth:
+		target, err := availableName(opt.DestFs, dest)
+		if err != nil {
+			return "", false, false, destError("stat", src, dest, err)
+		}
+
+		// The source is copied there, Mirror must not remove it.
+		opt.written.add(target)
+
+		return target, false, false, nil
+
+	case Overwrite:
+	}
+
+	return dest, true, false, nil
+}
+
+// availableName returns the first name like "name (1).ext" next to dest that does not exist yet.
+func availableName(fs afero.Fs, dest string) (string, error) {
+	ext := filepath.Ext(dest)
+	base := strings.TrimSuffix(dest, ext)
+
+	for i := 1; i <= maxKeepBothAttempts; i++ {
+		name := fmt.Sprintf("%s (%d)%s", base, i, ext)
+
+		_, err := stat(fs, name)
+		if os.IsNotExist(err) {
+			return name, nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", &os.PathError{Op: "stat", Path: dest, Err: os.ErrExist}
+}
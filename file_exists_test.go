@@ -0,0 +1,196 @@
+package aferocopy
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func onFileExists(action FileExistsAction) func(afero.Fs, string, os.FileInfo, afero.Fs, string, os.FileInfo) FileExistsAction {
+	return func(afero.Fs, string, os.FileInfo, afero.Fs, string, os.FileInfo) FileExistsAction {
+		return action
+	}
+}
+
+func TestOptions_OnFileExists(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		scenario  string
+		action    FileExistsAction
+		destMtime time.Time
+		expected  string
+	}{
+		{
+			scenario:  "overwrite",
+			action:    Overwrite,
+			destMtime: mtime.Add(time.Hour),
+			expected:  "hello",
+		},
+		{
+			scenario:  "keep existing",
+			action:    KeepExisting,
+			destMtime: mtime.Add(-time.Hour),
+			expected:  "existing",
+		},
+		{
+			scenario:  "source is newer",
+			action:    OverwriteIfNewer,
+			destMtime: mtime.Add(-time.Hour),
+			expected:  "hello",
+		},
+		{
+			scenario:  "source is not newer",
+			action:    OverwriteIfNewer,
+			destMtime: mtime,
+			expected:  "existing",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			fs := afero.NewMemMapFs()
+
+			require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("hello"), 0o644))
+			require.NoError(t, fs.Chtimes("/src/a.txt", mtime, mtime))
+			require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte("existing"), 0o644))
+			require.NoError(t, fs.Chtimes("/dest/a.txt", tc.destMtime, tc.destMtime))
+
+			err := Copy("/src", "/dest", Options{SrcFs: fs, OnFileExists: onFileExists(tc.action)})
+			require.NoError(t, err)
+
+			content, err := afero.ReadFile(fs, "/dest/a.txt")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(content))
+		})
+	}
+}
+
+func TestOptions_OnFileExists_FailIfExists(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("hello"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/b.txt", []byte("hello"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte("existing"), 0o644))
+
+	err := Copy("/src", "/dest", Options{SrcFs: fs, OnFileExists: onFileExists(FailIfExists)})
+	require.ErrorIs(t, err, os.ErrExist)
+
+	var copyErr *CopyError
+
+	require.ErrorAs(t, err, &copyErr)
+	assert.Equal(t, "create", copyErr.Op)
+	assert.Equal(t, "/dest/a.txt", copyErr.Dest)
+	assert.Equal(t, DestSide, copyErr.Fs)
+
+	content, err := afero.ReadFile(fs, "/dest/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "existing", string(content))
+}
+
+func TestOptions_OnFileExists_KeepBoth(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("hello"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte("existing"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dest/a (1).txt", []byte("existing too"), 0o644))
+
+	err := Copy("/src", "/dest", Options{SrcFs: fs, OnFileExists: onFileExists(KeepBoth)})
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		"/dest/a.txt":     "existing",
+		"/dest/a (1).txt": "existing too",
+		"/dest/a (2).txt": "hello",
+	}
+
+	for name, want := range expected {
+		content, err := afero.ReadFile(fs, name)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(content), name)
+	}
+}
+
+func TestOptions_OnFileExists_KeepBoth_Mirror(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, map[string]string{
+		"/src/a.txt":      "hello",
+		"/dest/a.txt":     "existing",
+		"/dest/a (1).txt": "stale",
+	})
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:        fs,
+		MirrorDest:   true,
+		OnFileExists: onFileExists(KeepBoth),
+	})
+	require.NoError(t, err)
+
+	// The copy of the source is kept, the copy of a previous one is not.
+	assert.Equal(t, []string{"a (2).txt", "a.txt"}, dirNames(t, fs, "/dest"))
+	assert.Equal(t, []string{"/dest/a (1).txt"}, result.Removed)
+
+	content, err := afero.ReadFile(fs, "/dest/a (2).txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+}
+
+func TestOptions_OnFileExists_NotCalled(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("hello"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/b.txt", []byte("b"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte("hello"), 0o644))
+
+	var called []string
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:  fs,
+		Update: UpdateChecksum,
+		OnFileExists: func(_ afero.Fs, src string, _ os.FileInfo, _ afero.Fs, _ string, _ os.FileInfo) FileExistsAction {
+			called = append(called, src)
+
+			return KeepExisting
+		},
+	})
+	require.NoError(t, err)
+
+	// The file that is up to date is skipped before, and the missing one does not exist.
+	assert.Empty(t, called)
+	assert.Equal(t, []SkippedEntry{{Src: "/src/a.txt", Dest: "/dest/a.txt", Reason: SkippedUpToDate}}, result.Skipped)
+}
+
+func TestOptions_OnFileExists_Result(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("hello"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte("existing"), 0o644))
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:        fs,
+		OnFileExists: onFileExists(KeepExisting),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(0), result.Files)
+	assert.Equal(t, []SkippedEntry{{Src: "/src/a.txt", Dest: "/dest/a.txt", Reason: SkippedExisting}}, result.Skipped)
+	assert.Equal(t, "already exists", SkippedExisting.String())
+}
@@ -0,0 +1,24 @@
+package aferocopy
+
+import (
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+// newFixtureFs returns a MemMapFs with the files, by path, and their content. The files are 0644 and the directories
+// 0755, the tests change what they need.
+func newFixtureFs(t *testing.T, files map[string]string) afero.Fs {
+	t.Helper()
+
+	fs := afero.NewMemMapFs()
+
+	for name, content := range files {
+		require.NoError(t, fs.MkdirAll(path.Dir(name), 0o755))
+		require.NoError(t, afero.WriteFile(fs, name, []byte(content), 0o644))
+	}
+
+	return fs
+}
@@ -0,0 +1,85 @@
+package aferocopy
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// matchGlob tells whether name matches pattern. Both are slash-separated. In the pattern, a "**" segment matches any
+// number of segments, even none, and the other segments are matched like path.Match.
+func matchGlob(pattern, name string) (bool, error) {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+
+			if len(pattern) == 0 {
+				return true, nil
+			}
+
+			for i := 0; i <= len(name); i++ {
+				if ok, err := matchSegments(pattern, name[i:]); err != nil || ok {
+					return ok, err
+				}
+			}
+
+			return false, nil
+		}
+
+		if len(name) == 0 {
+			return false, nil
+		}
+
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false, err
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0, nil
+}
+
+// checkPatterns checks that the patterns of Options.Include and Options.Exclude are well-formed.
+func checkPatterns(opt Options) error {
+	for _, patterns := range [][]string{opt.Include, opt.Exclude} {
+		for _, pattern := range patterns {
+			for _, segment := range strings.Split(pattern, "/") {
+				if _, err := path.Match(segment, ""); err != nil {
+					return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// filtered tells whether the entry at rel, relative to the root, is left out by Options.Include and Options.Exclude.
+func filtered(rel string, info os.FileInfo, opt Options) (bool, error) {
+	rel = filepath.ToSlash(rel)
+
+	for _, pattern := range opt.Exclude {
+		if ok, err := matchGlob(pattern, rel); err != nil || ok {
+			return ok, err
+		}
+	}
+
+	if len(opt.Include) == 0 || info.IsDir() {
+		return false, nil
+	}
+
+	for _, pattern := range opt.Include {
+		if ok, err := matchGlob(pattern, rel); err != nil || ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,149 @@
+package aferocopy
+
+import (
+	"context"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchGlob(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{pattern: "*.txt", name: "a.txt", expected: true},
+		{pattern: "*.txt", name: "dir/a.txt", expected: false},
+		{pattern: "**/*.txt", name: "a.txt", expected: true},
+		{pattern: "**/*.txt", name: "dir/sub/a.txt", expected: true},
+		{pattern: "dir/**", name: "dir", expected: true},
+		{pattern: "dir/**", name: "dir/sub/a.txt", expected: true},
+		{pattern: "dir/**", name: "other/a.txt", expected: false},
+		{pattern: "dir/**/a.txt", name: "dir/a.txt", expected: true},
+		{pattern: "dir/**/a.txt", name: "dir/x/y/a.txt", expected: true},
+		{pattern: "dir/**/a.txt", name: "dir/x/y/b.txt", expected: false},
+		{pattern: "**", name: "anything/at/all", expected: true},
+		{pattern: "d?r/[ab].txt", name: "dir/b.txt", expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+" "+tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := matchGlob(tc.pattern, tc.name)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+// openRecordingFs records the names opened from it.
+type openRecordingFs struct {
+	afero.Fs
+
+	mu     sync.Mutex
+	opened []string
+}
+
+func (fs *openRecordingFs) Open(name string) (afero.File, error) {
+	fs.mu.Lock()
+	fs.opened = append(fs.opened, name)
+	fs.mu.Unlock()
+
+	return fs.Fs.Open(name)
+}
+
+// filterFixture is a source with files to include and to exclude, at several depths.
+var filterFixture = map[string]string{
+	"/src/README.md":                 "README.md",
+	"/src/main.go":                   "main.go",
+	"/src/debug.log":                 "debug.log",
+	"/src/cmd/app/main.go":           "main.go",
+	"/src/cmd/app/app.log":           "app.log",
+	"/src/docs/guide.md":             "guide.md",
+	"/src/node_modules/pkg/index.js": "index.js",
+}
+
+func TestOptions_IncludeExclude(t *testing.T) {
+	t.Parallel()
+
+	srcFs := &openRecordingFs{Fs: newFixtureFs(t, filterFixture)}
+	destFs := afero.NewMemMapFs()
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:   srcFs,
+		DestFs:  destFs,
+		Include: []string{"**/*.go", "**/*.md", "**/*.js"},
+		Exclude: []string{"node_modules/**", "docs/*.md"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"README.md", "cmd", "docs", "main.go"}, dirNames(t, destFs, "/dest"))
+	assert.Equal(t, []string{"main.go"}, dirNames(t, destFs, "/dest/cmd/app"))
+	assert.Empty(t, dirNames(t, destFs, "/dest/docs"))
+
+	// The excluded directory is never read.
+	assert.NotContains(t, srcFs.opened, "/src/node_modules")
+
+	assert.ElementsMatch(t, []SkippedEntry{
+		{Src: "/src/cmd/app/app.log", Dest: "/dest/cmd/app/app.log", Reason: SkippedByFilter},
+		{Src: "/src/debug.log", Dest: "/dest/debug.log", Reason: SkippedByFilter},
+		{Src: "/src/docs/guide.md", Dest: "/dest/docs/guide.md", Reason: SkippedByFilter},
+		{Src: "/src/node_modules", Dest: "/dest/node_modules", Reason: SkippedByFilter},
+	}, result.Skipped)
+}
+
+func TestOptions_Include_Directories(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, filterFixture)
+
+	err := Copy("/src", "/dest", Options{SrcFs: fs, Include: []string{"**/*.go"}})
+	require.NoError(t, err)
+
+	// The directories are created even when none of their files is included.
+	assert.Equal(t, []string{"cmd", "docs", "main.go", "node_modules"}, dirNames(t, fs, "/dest"))
+	assert.Equal(t, []string{"main.go"}, dirNames(t, fs, "/dest/cmd/app"))
+	assert.Empty(t, dirNames(t, fs, "/dest/docs"))
+	assert.Empty(t, dirNames(t, fs, "/dest/node_modules/pkg"))
+}
+
+func TestOptions_Exclude_WinsOverInclude(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, filterFixture)
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:   fs,
+		Include: []string{"main.go"},
+		Exclude: []string{"main.go"},
+	})
+	require.NoError(t, err)
+
+	exists, err := afero.Exists(fs, "/dest/main.go")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestOptions_IncludeExclude_BadPattern(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, filterFixture)
+
+	err := Copy("/src", "/dest", Options{SrcFs: fs, Exclude: []string{"**/[.log"}})
+	require.EqualError(t, err, `invalid pattern "**/[.log": syntax error in pattern`)
+
+	_, err = Plan("/src", "/dest", Options{SrcFs: fs, Include: []string{"docs/["}})
+	require.ErrorIs(t, err, path.ErrBadPattern)
+
+	exists, err := afero.Exists(fs, "/dest")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
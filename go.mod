@@ -6,6 +6,7 @@ require (
 	github.com/spf13/afero v1.15.0
 	github.com/stretchr/testify v1.11.1
 	go.nhat.io/aferomock v0.8.0
+	golang.org/x/sys v0.35.0
 )
 
 require (
@@ -0,0 +1,184 @@
+package aferocopy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// ErrNoHardLink is returned by a HardLinker that cannot create hard links.
+var ErrNoHardLink = errors.New("hard links are not supported")
+
+// HardLinker is implemented by the filesystems that can create hard links, for Options.PreserveHardLinks.
+// afero.OsFs can without it.
+type HardLinker interface {
+	LinkIfPossible(oldname, newname string) error
+}
+
+// link creates newname as a hard link to oldname with the filesystem, if it can.
+func link(fs afero.Fs, oldname, newname string) error {
+	switch fs := fs.(type) {
+	case HardLinker:
+		return fs.LinkIfPossible(oldname, newname)
+
+	case *afero.OsFs:
+		return os.Link(oldname, newname)
+	}
+
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrNoHardLink}
+}
+
+// cannotLink tells whether the error of link is because the file cannot be linked there, so that it is copied
+// instead. The other errors are errors of the copy.
+func cannotLink(err error) bool {
+	return errors.Is(err, ErrNoHardLink) || errors.Is(err, errors.ErrUnsupported) || linkUnsupported(err)
+}
+
+// canLink tells whether the filesystem may create hard links.
+func canLink(fs afero.Fs) bool {
+	switch fs.(type) {
+	case HardLinker, *afero.OsFs:
+		return true
+	}
+
+	return false
+}
+
+// inode identifies a file in the source.
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// linkTracker remembers where the source files that have other hard links are copied, so that the next ones are
+// linked to them instead of being copied again.
+type linkTracker struct {
+	mu    sync.Mutex
+	files map[inode]*linkedFile
+}
+
+// linkedFile is a source file that has other hard links. The first of them to be copied is the one the others are
+// linked to, once it is done.
+type linkedFile struct {
+	done chan struct{}
+	dest string
+}
+
+func newLinkTracker() *linkTracker {
+	return &linkTracker{files: make(map[inode]*linkedFile)}
+}
+
+// claim returns the file with the inode, and whether it is the first of its links to be copied.
+func (t *linkTracker) claim(key inode) (*linkedFile, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if f, ok := t.files[key]; ok {
+		return f, false
+	}
+
+	f := &linkedFile{done: make(chan struct{})}
+	t.files[key] = f
+
+	return f, true
+}
+
+// copied records where the first link of the file is copied, so that the others are linked to it.
+func (f *linkedFile) copied(dest string) {
+	if f != nil {
+		f.dest = dest
+	}
+}
+
+// copyOrLinkFile copies the file src, or links it to where another hard link of it is copied, with
+// Options.PreserveHardLinks.
+func copyOrLinkFile(src, dest string, info os.FileInfo, opt Options) error {
+	key, ok := fileInode(info)
+	if opt.links == nil || !ok {
+		return copyFile(src, dest, info, opt)
+	}
+
+	f, first := opt.links.claim(key)
+	if first {
+		defer close(f.done)
+
+		opt.linked = f
+
+		return copyFile(src, dest, info, opt)
+	}
+
+	select {
+	case <-f.done:
+	case <-opt.ctx.Done():
+		return checkContext(opt.ctx, src, dest)
+	}
+
+	// The first link is not copied, like when it is up to date.
+	if f.dest == "" {
+		return copyFile(src, dest, info, opt)
+	}
+
+	linked, err := linkFile(src, dest, f.dest, info, opt)
+	if err != nil || linked {
+		return err
+	}
+
+	// The destination cannot link.
+	return copyFile(src, dest, info, opt)
+}
+
+// linkFile links dest to first, the destination of another hard link of src, like copyFile would copy it. It tells
+// whether the file is linked, or skipped.
+func linkFile(src, dest, first string, info os.FileInfo, opt Options) (bool, error) {
+	destFs := opt.DestFs
+
+	// The file is checked like copyFile would, with its transformer.
+	opt.transform = transformer(src, info, opt)
+
+	dest, overwrite, skip, err := checkFile(src, dest, info, opt)
+	if err != nil || skip {
+		return true, err
+	}
+
+	if err := destFs.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return false, destError("mkdir", src, dest, err)
+	}
+
+	// An existing destination is replaced by renaming the link over it.
+	target := dest
+
+	if _, err := stat(destFs, dest); opt.Atomic || err == nil {
+		target = siblingName(dest, "tmp")
+	}
+
+	if err := link(destFs, first, target); err != nil {
+		if cannotLink(err) {
+			return false, nil
+		}
+
+		return true, destError("link", src, dest, err)
+	}
+
+	if target != dest {
+		if overwrite && opt.Backup != NoBackup {
+			if err := backupFile(src, dest, true, opt); err != nil {
+				ignore(destFs.Remove(target))
+
+				return true, err
+			}
+		}
+
+		if err := destFs.Rename(target, dest); err != nil {
+			ignore(destFs.Remove(target))
+
+			return true, destError("rename", src, dest, err)
+		}
+	}
+
+	opt.result.addHardLink()
+
+	return true, nil
+}
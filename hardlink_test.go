@@ -0,0 +1,242 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package aferocopy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newHardLinkFixture creates a source where a.txt, b.txt and sub/c.txt are hard links to the same file.
+func newHardLinkFixture(t *testing.T) (src, dest string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	src, dest = filepath.Join(dir, "src"), filepath.Join(dir, "dest")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("shared"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "other.txt"), []byte("other"), 0o644))
+	require.NoError(t, os.Link(filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")))
+	require.NoError(t, os.Link(filepath.Join(src, "a.txt"), filepath.Join(src, "sub", "c.txt")))
+
+	return src, dest
+}
+
+func sameFile(t *testing.T, a, b string) bool {
+	t.Helper()
+
+	ia, err := os.Stat(a)
+	require.NoError(t, err)
+
+	ib, err := os.Stat(b)
+	require.NoError(t, err)
+
+	return os.SameFile(ia, ib)
+}
+
+func TestOptions_PreserveHardLinks(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario    string
+		concurrency int
+	}{
+		{scenario: "sequential"},
+		{scenario: "concurrent", concurrency: 4},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			src, dest := newHardLinkFixture(t)
+
+			// An existing destination is replaced.
+			require.NoError(t, os.MkdirAll(dest, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(dest, "b.txt"), []byte("old"), 0o644))
+
+			res, err := CopyWithResult(context.Background(), src, dest, Options{
+				PreserveHardLinks: true,
+				Concurrency:       tc.concurrency,
+			})
+			require.NoError(t, err)
+
+			assert.True(t, sameFile(t, filepath.Join(dest, "a.txt"), filepath.Join(dest, "b.txt")))
+			assert.True(t, sameFile(t, filepath.Join(dest, "a.txt"), filepath.Join(dest, "sub", "c.txt")))
+			assert.False(t, sameFile(t, filepath.Join(dest, "a.txt"), filepath.Join(src, "a.txt")))
+			assert.False(t, sameFile(t, filepath.Join(dest, "a.txt"), filepath.Join(dest, "other.txt")))
+
+			content, err := os.ReadFile(filepath.Join(dest, "b.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "shared", string(content))
+
+			assert.Equal(t, int64(2), res.Files)
+			assert.Equal(t, int64(2), res.HardLinks)
+		})
+	}
+}
+
+func TestOptions_PreserveHardLinks_Disabled(t *testing.T) {
+	t.Parallel()
+
+	src, dest := newHardLinkFixture(t)
+
+	err := Copy(src, dest)
+	require.NoError(t, err)
+
+	assert.False(t, sameFile(t, filepath.Join(dest, "a.txt"), filepath.Join(dest, "b.txt")))
+}
+
+func TestOptions_PreserveHardLinks_CannotLink(t *testing.T) {
+	t.Parallel()
+
+	src, _ := newHardLinkFixture(t)
+	destFs := afero.NewMemMapFs()
+
+	res, err := CopyWithResult(context.Background(), src, "/dest", Options{
+		SrcFs:             afero.NewOsFs(),
+		DestFs:            destFs,
+		PreserveHardLinks: true,
+	})
+	require.NoError(t, err)
+
+	for _, name := range []string{"/dest/a.txt", "/dest/b.txt", "/dest/sub/c.txt"} {
+		content, err := afero.ReadFile(destFs, name)
+		require.NoError(t, err)
+		assert.Equal(t, "shared", string(content))
+	}
+
+	assert.Equal(t, int64(4), res.Files)
+	assert.Zero(t, res.HardLinks)
+}
+
+func TestOptions_PreserveHardLinks_BasePathFs(t *testing.T) {
+	t.Parallel()
+
+	src, dest := newHardLinkFixture(t)
+	require.NoError(t, os.Mkdir(dest, 0o755))
+
+	opt := Options{
+		SrcFs:             afero.NewOsFs(),
+		DestFs:            NewBasePathFs(afero.NewOsFs(), dest),
+		PreserveHardLinks: true,
+	}
+
+	ops, err := Plan(src, "/copy", opt)
+	require.NoError(t, err)
+	assert.Contains(t, ops, Operation{Type: OpLink, Path: "/copy/b.txt", Target: "/copy/a.txt"})
+
+	err = Copy(src, "/copy", opt)
+	require.NoError(t, err)
+
+	assert.True(t, sameFile(t, filepath.Join(dest, "copy", "a.txt"), filepath.Join(dest, "copy", "sub", "c.txt")))
+}
+
+// linkErrorFs fails to create hard links with the error.
+type linkErrorFs struct {
+	afero.Fs
+
+	err error
+}
+
+func (fs *linkErrorFs) LinkIfPossible(oldname, newname string) error {
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.err}
+}
+
+func TestOptions_PreserveHardLinks_LinkError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		err      error
+		files    int64
+	}{
+		{scenario: "another device", err: syscall.EXDEV, files: 4},
+		{scenario: "not permitted", err: syscall.EPERM, files: 4},
+		{scenario: "too many links", err: syscall.EMLINK, files: 4},
+		{scenario: "not supported", err: syscall.ENOTSUP, files: 4},
+		{scenario: "other error", err: syscall.EIO, files: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			src, dest := newHardLinkFixture(t)
+
+			var failures []*CopyError
+
+			res, err := CopyWithResult(context.Background(), src, dest, Options{
+				SrcFs:             afero.NewOsFs(),
+				DestFs:            &linkErrorFs{Fs: afero.NewOsFs(), err: tc.err},
+				PreserveHardLinks: true,
+				OnError: func(err *CopyError) ErrorAction {
+					failures = append(failures, err)
+
+					return Continue
+				},
+			})
+
+			// The files that cannot be linked there are copied, the other errors are errors of the copy.
+			assert.Equal(t, tc.files, res.Files)
+			assert.Zero(t, res.HardLinks)
+
+			if tc.files == 4 {
+				require.NoError(t, err)
+				assert.Empty(t, failures)
+
+				return
+			}
+
+			require.ErrorIs(t, err, syscall.EIO)
+			require.Len(t, failures, 2)
+
+			for _, failure := range failures {
+				assert.Equal(t, "link", failure.Op)
+				assert.Equal(t, DestSide, failure.Fs)
+			}
+		})
+	}
+}
+
+func TestOptions_PreserveHardLinks_Transform(t *testing.T) {
+	t.Parallel()
+
+	src, dest := newHardLinkFixture(t)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dest, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "b.txt"), []byte("SHARED"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "sub", "c.txt"), []byte("stale"), 0o644))
+
+	res, err := CopyWithResult(context.Background(), src, dest, Options{
+		PreserveHardLinks: true,
+		Update:            UpdateChecksum,
+		Transform: func(string, os.FileInfo) *Transformer {
+			return &Transformer{Reader: func(r io.Reader) (io.Reader, error) {
+				content, err := io.ReadAll(r)
+
+				return bytes.NewReader(bytes.ToUpper(content)), err
+			}}
+		},
+	})
+	require.NoError(t, err)
+
+	// The link is compared with the transformed source, like a copy.
+	assert.Equal(t, []SkippedEntry{
+		{Src: filepath.Join(src, "b.txt"), Dest: filepath.Join(dest, "b.txt"), Reason: SkippedUpToDate},
+	}, res.Skipped)
+	assert.Equal(t, int64(1), res.HardLinks)
+	assert.False(t, sameFile(t, filepath.Join(dest, "a.txt"), filepath.Join(dest, "b.txt")))
+	assert.True(t, sameFile(t, filepath.Join(dest, "a.txt"), filepath.Join(dest, "sub", "c.txt")))
+}
@@ -0,0 +1,25 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package aferocopy
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode of the file, if it has other hard links.
+func fileInode(info os.FileInfo) (inode, bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Nlink > 1 {
+		return inode{dev: uint64(stat.Dev), ino: stat.Ino}, true //nolint: unconvert
+	}
+
+	return inode{}, false
+}
+
+// linkUnsupported tells whether the error of a link is because the file cannot be linked there: another device, a
+// filesystem that does not allow it, or too many links already.
+func linkUnsupported(err error) bool {
+	return errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EMLINK)
+}
@@ -0,0 +1,26 @@
+//go:build windows
+// +build windows
+
+package aferocopy
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+const (
+	errorInvalidFunction = syscall.Errno(1)    // ERROR_INVALID_FUNCTION, returned by the volumes without hard links.
+	errorNotSameDevice   = syscall.Errno(17)   // ERROR_NOT_SAME_DEVICE.
+	errorTooManyLinks    = syscall.Errno(1142) // ERROR_TOO_MANY_LINKS.
+)
+
+// fileInode does not tell the inodes of the files.
+func fileInode(_ os.FileInfo) (inode, bool) {
+	return inode{}, false
+}
+
+// linkUnsupported tells whether the error of a link is because the file cannot be linked there.
+func linkUnsupported(err error) bool {
+	return errors.Is(err, errorInvalidFunction) || errors.Is(err, errorNotSameDevice) || errors.Is(err, errorTooManyLinks)
+}
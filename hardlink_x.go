@@ -0,0 +1,18 @@
+//go:build plan9
+// +build plan9
+
+package aferocopy
+
+import (
+	"os"
+)
+
+// fileInode does not tell the inodes of the files.
+func fileInode(_ os.FileInfo) (inode, bool) {
+	return inode{}, false
+}
+
+// linkUnsupported does not tell the errors of the system.
+func linkUnsupported(_ error) bool {
+	return false
+}
@@ -0,0 +1,135 @@
+package aferocopy
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// ignoreRule is a pattern of an ignore file.
+type ignoreRule struct {
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreFile is the rules of an ignore file, that apply to the directory it is in, and below.
+type ignoreFile struct {
+	// dir is the path of the directory, relative to the source and slash-separated.
+	dir   string
+	rules []ignoreRule
+}
+
+// parseIgnoreFile parses the content of an ignore file, like a .gitignore. The malformed patterns are ignored.
+func parseIgnoreFile(data []byte) []ignoreRule {
+	var rules []ignoreRule
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		// A pattern with a slash, other than at the end, is anchored to the directory of the ignore file.
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+
+		// Like git, a trailing "/**" matches what is inside the directory, but not the directory itself.
+		if strings.HasSuffix(line, "/**") {
+			line += "/*"
+		}
+
+		if line == "" || checkPatterns(Options{Exclude: []string{line}}) != nil {
+			continue
+		}
+
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// loadIgnoreFiles reads the ignore files of Options.IgnoreFiles among the contents of srcDir, and returns the rules
+// that apply to its entries.
+func loadIgnoreFiles(srcDir, destDir string, contents []os.FileInfo, opt Options) ([]ignoreFile, error) {
+	ignores := opt.ignores
+
+	for _, name := range opt.IgnoreFiles {
+		for _, content := range contents {
+			if content.Name() != name || !content.Mode().IsRegular() {
+				continue
+			}
+
+			src := filepath.Join(srcDir, name)
+
+			data, err := afero.ReadFile(opt.SrcFs, src)
+			if err != nil {
+				return nil, srcError("read", src, filepath.Join(destDir, name), err)
+			}
+
+			// Do not share the rules of the siblings.
+			ignores = append(ignores[:len(ignores):len(ignores)], ignoreFile{
+				dir:   filepath.ToSlash(opt.rel),
+				rules: parseIgnoreFile(data),
+			})
+		}
+	}
+
+	return ignores, nil
+}
+
+// ignored tells whether the entry at rel, relative to the source, is ignored by the ignore files. Like git, the last
+// matching rule wins, and the rules of the deeper ignore files come last.
+func ignored(rel string, info os.FileInfo, ignores []ignoreFile) bool {
+	rel = filepath.ToSlash(rel)
+	out := false
+
+	for _, f := range ignores {
+		name := rel
+
+		if f.dir != "" {
+			var ok bool
+
+			if name, ok = strings.CutPrefix(rel, f.dir+"/"); !ok {
+				continue
+			}
+		}
+
+		for _, rule := range f.rules {
+			if rule.dirOnly && !info.IsDir() {
+				continue
+			}
+
+			if ok, _ := matchGlob(rule.pattern, name); ok { //nolint: errcheck // The patterns are checked when parsed.
+				out = !rule.negate
+			}
+		}
+	}
+
+	return out
+}
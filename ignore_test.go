@@ -0,0 +1,121 @@
+package aferocopy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIgnoreFile(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("# comment\n\n*.log\n!keep.log\nbuild/\n/secret.txt\ndocs/*.md  \n\\!important\nvendor/**\n[bad\n")
+
+	expected := []ignoreRule{
+		{pattern: "**/*.log"},
+		{pattern: "**/keep.log", negate: true},
+		{pattern: "**/build", dirOnly: true},
+		{pattern: "secret.txt"},
+		{pattern: "docs/*.md"},
+		{pattern: "**/!important"},
+		{pattern: "vendor/**/*"},
+	}
+
+	assert.Equal(t, expected, parseIgnoreFile(data))
+}
+
+func TestOptions_IgnoreFiles(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	files := map[string]string{
+		"/src/.gitignore":       "*.log\n!keep.log\nbuild/\n/secret.txt\n",
+		"/src/app.log":          "",
+		"/src/keep.log":         "",
+		"/src/secret.txt":       "",
+		"/src/build/out.bin":    "",
+		"/src/sub/.gitignore":   "!*.log\nlocal.txt\n",
+		"/src/sub/debug.log":    "",
+		"/src/sub/local.txt":    "",
+		"/src/sub/secret.txt":   "",
+		"/src/sub/build":        "",
+		"/src/other/local.txt":  "",
+		"/src/other/other.log":  "",
+		"/src/.dockerignore":    "other\n",
+		"/src/other2/other.txt": "",
+	}
+
+	for name, content := range files {
+		require.NoError(t, afero.WriteFile(fs, name, []byte(content), 0o644))
+	}
+
+	srcFs := &openRecordingFs{Fs: fs}
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:       srcFs,
+		DestFs:      fs,
+		IgnoreFiles: []string{".gitignore"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{".dockerignore", ".gitignore", "keep.log", "other", "other2", "sub"}, dirNames(t, fs, "/dest"))
+	assert.Equal(t, []string{".gitignore", "build", "debug.log", "secret.txt"}, dirNames(t, fs, "/dest/sub"))
+	assert.Equal(t, []string{"local.txt"}, dirNames(t, fs, "/dest/other"))
+
+	// The ignored directory is never read.
+	assert.NotContains(t, srcFs.opened, "/src/build")
+
+	assert.ElementsMatch(t, []SkippedEntry{
+		{Src: "/src/app.log", Dest: "/dest/app.log", Reason: SkippedByIgnoreFile},
+		{Src: "/src/build", Dest: "/dest/build", Reason: SkippedByIgnoreFile},
+		{Src: "/src/secret.txt", Dest: "/dest/secret.txt", Reason: SkippedByIgnoreFile},
+		{Src: "/src/sub/local.txt", Dest: "/dest/sub/local.txt", Reason: SkippedByIgnoreFile},
+		{Src: "/src/other/other.log", Dest: "/dest/other/other.log", Reason: SkippedByIgnoreFile},
+	}, result.Skipped)
+}
+
+func TestOptions_IgnoreFiles_DirectoryContents(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, map[string]string{
+		"/src/.gitignore":      "foo/**\n!foo/bar\n",
+		"/src/foo/a.txt":       "a",
+		"/src/foo/bar":         "bar",
+		"/src/foo/sub/bar":     "sub bar",
+		"/src/foo/sub/b.txt":   "b",
+		"/src/other/foo/c.txt": "c",
+	})
+
+	err := Copy("/src", "/dest", Options{SrcFs: fs, IgnoreFiles: []string{".gitignore"}})
+	require.NoError(t, err)
+
+	// The directory itself is not ignored, so what is inside can be kept.
+	assert.Equal(t, []string{"bar"}, dirNames(t, fs, "/dest/foo"))
+	assert.Equal(t, []string{"c.txt"}, dirNames(t, fs, "/dest/other/foo"))
+}
+
+func TestOptions_IgnoreFiles_WithSkip(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/.dockerignore", []byte("a.txt\n"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("a"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/b.txt", []byte("b"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/c.txt", []byte("c"), 0o644))
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:       fs,
+		IgnoreFiles: []string{".gitignore", ".dockerignore"},
+		Skip: func(_ afero.Fs, src string) (bool, error) {
+			return src == "/src/b.txt", nil
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{".dockerignore", "c.txt"}, dirNames(t, fs, "/dest"))
+}
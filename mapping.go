@@ -0,0 +1,169 @@
+package aferocopy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// pathMapper remembers where the entries are copied with Options.MapPath, to detect the collisions, and to mirror
+// the directories once everything is copied.
+type pathMapper struct {
+	mu       sync.Mutex
+	dests    map[string]mappedEntry
+	left     map[string]struct{}
+	mirrored []mirroredDir
+}
+
+// mirroredDir is a directory to mirror once everything is copied.
+type mirroredDir struct {
+	src  string
+	dest string
+	info os.FileInfo
+}
+
+// mappedEntry is an entry copied to a mapped destination.
+type mappedEntry struct {
+	src string
+	dir bool
+}
+
+func newPathMapper() *pathMapper {
+	return &pathMapper{dests: make(map[string]mappedEntry), left: make(map[string]struct{})}
+}
+
+// destPath returns the destination of the entry of destDir, following Options.MapPath, or skip if it should not be
+// copied. The destination is claimed later, once the entry passes the filters.
+func destPath(src, destDir string, info os.FileInfo, opt Options) (dest string, skip bool, err error) {
+	dest = filepath.Join(destDir, info.Name())
+
+	if opt.MapPath == nil {
+		return dest, false, nil
+	}
+
+	mapped, ok := opt.MapPath(opt.rel, info)
+	if !ok {
+		return dest, true, nil
+	}
+
+	mapped = filepath.Clean(mapped)
+
+	// Only directories can be mapped to the destination itself, to be merged into it.
+	if filepath.IsAbs(mapped) || mapped == ".." || strings.HasPrefix(mapped, ".."+string(filepath.Separator)) ||
+		(mapped == "." && !info.IsDir()) {
+		return dest, false, &CopyError{Op: "map", Src: src, Dest: dest, Err: fmt.Errorf("invalid destination %q", mapped)} //nolint: err113
+	}
+
+	return filepath.Join(opt.intent.dest, mapped), false, nil
+}
+
+// claim records that src is copied to dest, and fails if another entry is already copied there.
+// Only directories can be copied to the same destination, and they are merged.
+func (m *pathMapper) claim(src, dest string, dir bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if other, ok := m.dests[dest]; ok && (!dir || !other.dir) {
+		return &CopyError{Op: "map", Src: src, Dest: dest, Err: fmt.Errorf("already copied from %s", other.src)} //nolint: err113
+	}
+
+	m.dests[dest] = mappedEntry{src: src, dir: dir}
+
+	return nil
+}
+
+// leave records that the entry mapped to dest is left out of the copy, so that Mirror keeps what is there.
+func (m *pathMapper) leave(dest string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.left[dest] = struct{}{}
+}
+
+// deferMirror remembers to mirror destDir once everything is copied, because its entries may come from anywhere.
+func (m *pathMapper) deferMirror(srcDir, destDir string, info os.FileInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.mirrored = append(m.mirrored, mirroredDir{src: srcDir, dest: destDir, info: info})
+}
+
+// mirror removes the entries of the mirrored directories that nothing is copied to, or under.
+func (m *pathMapper) mirror(opt Options) error {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := make(map[string]struct{}, len(m.dests)+len(m.left))
+
+	for dest := range m.dests {
+		keepPath(kept, dest, opt)
+	}
+
+	for dest := range m.left {
+		keepPath(kept, dest, opt)
+	}
+
+	// The directories are mirrored after their entries, so the deepest ones come first.
+	for _, dir := range m.mirrored {
+		if err := m.mirrorDir(dir.src, dir.dest, kept, opt); err != nil {
+			return err
+		}
+
+		// Removing the entries touched the directory again.
+		if opt.PreserveTimes {
+			if err := preserveTimes(dir.info, opt.DestFs, dir.dest); err != nil {
+				return destError("chtimes", dir.src, dir.dest, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// keepPath adds dest and its parents, up to the destination, to kept.
+func keepPath(kept map[string]struct{}, dest string, opt Options) {
+	for p := dest; p != opt.intent.dest && p != filepath.Dir(p); p = filepath.Dir(p) {
+		kept[p] = struct{}{}
+	}
+}
+
+// mirrorDir removes the entries of destDir that are not kept, and mirrors the directories kept only because entries
+// are copied under them, since no source directory is copied to them. The entries left out of the copy are kept as
+// they are.
+func (m *pathMapper) mirrorDir(srcDir, destDir string, kept map[string]struct{}, opt Options) error {
+	var between []string
+
+	err := removeEntries(srcDir, destDir, func(entry os.FileInfo) (bool, error) {
+		dest := filepath.Join(destDir, entry.Name())
+
+		if _, ok := kept[dest]; !ok {
+			return false, nil
+		}
+
+		_, copied := m.dests[dest]
+		_, left := m.left[dest]
+
+		if !copied && !left {
+			between = append(between, dest)
+		}
+
+		return true, nil
+	}, opt)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range between {
+		if err := m.mirrorDir(srcDir, dir, kept, opt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package aferocopy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mappingFixture is a source with mixed case names at several depths.
+var mappingFixture = map[string]string{
+	"/src/A.txt":          "A.txt",
+	"/src/Docs/B.md":      "B.md",
+	"/src/Docs/Deep/C.md": "C.md",
+	"/src/tmp/d.tmp":      "d.tmp",
+}
+
+func lowercase(rel string, _ os.FileInfo) (string, bool) {
+	return strings.ToLower(rel), true
+}
+
+func TestOptions_MapPath(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		mapPath  func(rel string, info os.FileInfo) (string, bool)
+		expected map[string]string
+	}{
+		{
+			scenario: "lowercase",
+			mapPath:  lowercase,
+			expected: map[string]string{
+				"/dest/a.txt":          "A.txt",
+				"/dest/docs/b.md":      "B.md",
+				"/dest/docs/deep/c.md": "C.md",
+				"/dest/tmp/d.tmp":      "d.tmp",
+			},
+		},
+		{
+			scenario: "flatten",
+			mapPath: func(rel string, info os.FileInfo) (string, bool) {
+				if info.IsDir() {
+					return ".", true
+				}
+
+				return info.Name(), true
+			},
+			expected: map[string]string{
+				"/dest/A.txt": "A.txt",
+				"/dest/B.md":  "B.md",
+				"/dest/C.md":  "C.md",
+				"/dest/d.tmp": "d.tmp",
+			},
+		},
+		{
+			scenario: "prefix and skip",
+			mapPath: func(rel string, _ os.FileInfo) (string, bool) {
+				if rel == "tmp" {
+					return "", false
+				}
+
+				return filepath.Join("v1", rel), true
+			},
+			expected: map[string]string{
+				"/dest/v1/A.txt":          "A.txt",
+				"/dest/v1/Docs/B.md":      "B.md",
+				"/dest/v1/Docs/Deep/C.md": "C.md",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			fs := newFixtureFs(t, mappingFixture)
+
+			err := Copy("/src", "/dest", Options{SrcFs: fs, MapPath: tc.mapPath})
+			require.NoError(t, err)
+
+			actual := make(map[string]string)
+
+			err = afero.Walk(fs, "/dest", func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+
+				content, err := afero.ReadFile(fs, path)
+				actual[path] = string(content)
+
+				return err
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestOptions_MapPath_Collision(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, mappingFixture)
+	require.NoError(t, afero.WriteFile(fs, "/src/Docs/b.md", []byte("b.md"), 0o644))
+
+	err := Copy("/src", "/dest", Options{SrcFs: fs, MapPath: lowercase})
+	require.ErrorContains(t, err, "already copied from /src/Docs/")
+
+	var cerr *CopyError
+
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, "map", cerr.Op)
+	assert.Equal(t, "/dest/docs/b.md", cerr.Dest)
+
+	// The rest is copied when continuing on errors.
+	res, err := CopyWithResult(context.Background(), "/src", "/dest2", Options{
+		SrcFs:   fs,
+		MapPath: lowercase,
+		OnError: func(*CopyError) ErrorAction {
+			return Continue
+		},
+	})
+	require.ErrorContains(t, err, "already copied from")
+	assert.Equal(t, int64(4), res.Files)
+	assert.Equal(t, []string{"b.md", "deep"}, dirNames(t, fs, "/dest2/docs"))
+}
+
+func TestOptions_MapPath_LeftOut(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		options  Options
+	}{
+		{
+			scenario: "skip",
+			options: Options{Skip: func(_ afero.Fs, src string) (bool, error) {
+				return src == "/src/A.txt" || src == "/src/Docs/B.md", nil
+			}},
+		},
+		{
+			scenario: "exclude",
+			options:  Options{Exclude: []string{"A.txt", "Docs/B.md"}},
+		},
+		{
+			scenario: "ignore files",
+			options:  Options{IgnoreFiles: []string{".ignore"}},
+		},
+		{
+			scenario: "skip entry",
+			options: Options{SkipEntry: func(_ afero.Fs, src string, _ os.FileInfo, _ string, _ int) (bool, error) {
+				return src == "/src/A.txt" || src == "/src/Docs/B.md", nil
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			fs := newFixtureFs(t, mappingFixture)
+			require.NoError(t, afero.WriteFile(fs, "/src/.ignore", []byte("/A.txt\nDocs/B.md\n"), 0o644))
+			require.NoError(t, afero.WriteFile(fs, "/src/Docs/b.md", []byte("b.md"), 0o644))
+			require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte("old a"), 0o644))
+			require.NoError(t, afero.WriteFile(fs, "/dest/stale.txt", []byte("stale"), 0o644))
+
+			opt := tc.options
+			opt.SrcFs = fs
+			opt.MapPath = lowercase
+			opt.MirrorDest = true
+
+			// The entry that is left out does not take the destination of the other one.
+			err := Copy("/src", "/dest", opt)
+			require.NoError(t, err)
+
+			content, err := afero.ReadFile(fs, "/dest/docs/b.md")
+			require.NoError(t, err)
+			assert.Equal(t, "b.md", string(content))
+
+			// Mirror keeps what the entry that is left out would replace.
+			content, err = afero.ReadFile(fs, "/dest/a.txt")
+			require.NoError(t, err)
+			assert.Equal(t, "old a", string(content))
+
+			_, err = fs.Stat("/dest/stale.txt")
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestOptions_MapPath_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, mapped := range []string{"../escape", "/abs", "."} {
+		t.Run(mapped, func(t *testing.T) {
+			t.Parallel()
+
+			fs := newFixtureFs(t, mappingFixture)
+
+			err := Copy("/src", "/dest", Options{
+				SrcFs: fs,
+				MapPath: func(rel string, info os.FileInfo) (string, bool) {
+					if info.IsDir() {
+						return rel, true
+					}
+
+					return mapped, true
+				},
+			})
+			require.ErrorContains(t, err, "invalid destination")
+		})
+	}
+}
+
+func TestOptions_MapPath_Mirror(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, mappingFixture)
+	require.NoError(t, afero.WriteFile(fs, "/dest/v1/stale.txt", []byte("stale"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dest/v1/Docs/stale.md", []byte("stale"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dest/outside.txt", []byte("outside"), 0o644))
+
+	opt := Options{
+		SrcFs: fs,
+		MapPath: func(rel string, _ os.FileInfo) (string, bool) {
+			return filepath.Join("v1", rel), true
+		},
+		MirrorDest: true,
+		OnDirExists: func(afero.Fs, string, afero.Fs, string) DirExistsAction {
+			return Mirror
+		},
+	}
+
+	ops, err := Plan("/src", "/dest", opt)
+	require.NoError(t, err)
+	assert.Contains(t, ops, Operation{Type: OpRemove, Path: "/dest/outside.txt"})
+	assert.Contains(t, ops, Operation{Type: OpRemove, Path: "/dest/v1/stale.txt"})
+
+	res, err := CopyWithResult(context.Background(), "/src", "/dest", opt)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"v1"}, dirNames(t, fs, "/dest"))
+	assert.Equal(t, []string{"A.txt", "Docs", "tmp"}, dirNames(t, fs, "/dest/v1"))
+	assert.Equal(t, []string{"B.md", "Deep"}, dirNames(t, fs, "/dest/v1/Docs"))
+	assert.ElementsMatch(t, []string{"/dest/outside.txt", "/dest/v1/stale.txt", "/dest/v1/Docs/stale.md"}, res.Removed)
+}
@@ -0,0 +1,128 @@
+package aferocopy
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// writtenPaths are the destinations that the copy writes to other names than the ones of the source, like the
+// backups, so that Mirror does not remove them.
+type writtenPaths struct {
+	mu    sync.Mutex
+	paths map[string]struct{}
+}
+
+func newWrittenPaths() *writtenPaths {
+	return &writtenPaths{paths: make(map[string]struct{})}
+}
+
+func (w *writtenPaths) add(path string) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.paths[filepath.Clean(path)] = struct{}{}
+}
+
+func (w *writtenPaths) has(path string) bool {
+	if w == nil {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, ok := w.paths[filepath.Clean(path)]
+
+	return ok
+}
+
+// removeExtraneous removes the entries of destDir that do not exist in srcDir, for Mirror.
+// The entries that the copy would leave out if they were in the source are kept, as if they were excluded from the
+// mirror too.
+func removeExtraneous(srcDir, destDir string, contents []os.FileInfo, opt Options) error {
+	existing := make(map[string]struct{}, len(contents))
+
+	for _, content := range contents {
+		existing[content.Name()] = struct{}{}
+	}
+
+	return removeEntries(srcDir, destDir, func(entry os.FileInfo) (bool, error) {
+		if _, ok := existing[entry.Name()]; ok {
+			return true, nil
+		}
+
+		// The backups of the files of the source are left to Options.MaxBackups.
+		if name, ok := backupOf(entry.Name(), opt); ok && !entry.IsDir() {
+			if _, ok := existing[name]; ok {
+				return true, nil
+			}
+		}
+
+		child := opt
+		child.rel = filepath.Join(opt.rel, entry.Name())
+
+		// The entry is not in the source, it is checked with what it is in the destination.
+		_, out, err := leftOut(filepath.Join(srcDir, entry.Name()), filepath.Join(destDir, entry.Name()), entry, child)
+		if isSkipErr(err) {
+			return true, nil
+		}
+
+		return out, err
+	}, opt)
+}
+
+// removeEntries removes the entries of destDir that are not kept, nor written by the copy.
+func removeEntries(srcDir, destDir string, keep func(entry os.FileInfo) (bool, error), opt Options) error {
+	destFs := opt.DestFs
+
+	entries, err := afero.ReadDir(destFs, destDir)
+	if err != nil {
+		return destError("readdir", srcDir, destDir, err)
+	}
+
+	for _, entry := range entries {
+		cs, cd := filepath.Join(srcDir, entry.Name()), filepath.Join(destDir, entry.Name())
+
+		if err := checkContext(opt.ctx, cs, cd); err != nil {
+			return err
+		}
+
+		if opt.written.has(cd) {
+			continue
+		}
+
+		kept, err := keep(entry)
+		if err != nil {
+			return err
+		}
+
+		if kept {
+			continue
+		}
+
+		if entry.IsDir() {
+			err = destError("removeall", cs, cd, destFs.RemoveAll(cd))
+		} else {
+			err = destError("remove", cs, cd, destFs.Remove(cd))
+		}
+
+		if err == nil {
+			opt.result.remove(cd)
+
+			continue
+		}
+
+		if err = opt.handleError(cs, cd, err); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,294 @@
+package aferocopy
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mirrorFixture is a source, and a destination that has entries the source does not have anymore.
+var mirrorFixture = map[string]string{
+	"/src/a.txt":         "new a",
+	"/src/dir/b.txt":     "new b",
+	"/src/skipped.log":   "skipped",
+	"/dest/a.txt":        "old a",
+	"/dest/c.txt":        "old c",
+	"/dest/keep.log":     "keep",
+	"/dest/skipped.log":  "old skipped",
+	"/dest/dir/b.txt":    "old b",
+	"/dest/dir/d.txt":    "old d",
+	"/dest/olddir/e.txt": "old e",
+}
+
+func mirrorAll(afero.Fs, string, afero.Fs, string) DirExistsAction {
+	return Mirror
+}
+
+func skipLogs(_ afero.Fs, src string) (bool, error) {
+	return strings.HasSuffix(src, ".log"), nil
+}
+
+func TestOptions_OnDirExists_Mirror(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, mirrorFixture)
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:       fs,
+		MirrorDest:  true,
+		OnDirExists: mirrorAll,
+		Skip:        skipLogs,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/dest/c.txt", "/dest/olddir", "/dest/dir/d.txt"}, sortedByDepth(result.Removed))
+
+	expected := map[string]string{
+		"/dest/a.txt":       "new a",
+		"/dest/dir/b.txt":   "new b",
+		"/dest/keep.log":    "keep",
+		"/dest/skipped.log": "old skipped",
+	}
+
+	for name, content := range expected {
+		actual, err := afero.ReadFile(fs, name)
+		require.NoError(t, err, name)
+		assert.Equal(t, content, string(actual), name)
+	}
+
+	for _, name := range []string{"/dest/c.txt", "/dest/dir/d.txt", "/dest/olddir"} {
+		_, err := fs.Stat(name)
+		assert.True(t, os.IsNotExist(err), name)
+	}
+}
+
+func TestOptions_OnDirExists_MirrorOnlyTheRoot(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, mirrorFixture)
+
+	var called []string
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:      fs,
+		MirrorDest: true,
+		OnDirExists: func(_ afero.Fs, _ string, _ afero.Fs, dest string) DirExistsAction {
+			called = append(called, dest)
+
+			return Merge
+		},
+	})
+	require.NoError(t, err)
+
+	// OnDirExists is not called for the destination itself.
+	assert.Equal(t, []string{"/dest/dir"}, called)
+
+	_, err = fs.Stat("/dest/c.txt")
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = fs.Stat("/dest/dir/d.txt")
+	require.NoError(t, err)
+}
+
+func TestOptions_OnDirExists_MirrorNotTheRoot(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, mirrorFixture)
+
+	err := Copy("/src", "/dest", Options{SrcFs: fs, OnDirExists: mirrorAll})
+	require.NoError(t, err)
+
+	_, err = fs.Stat("/dest/c.txt")
+	require.NoError(t, err)
+
+	_, err = fs.Stat("/dest/dir/d.txt")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOptions_OnDirExists_MirrorLeftOut(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		options  Options
+	}{
+		{
+			scenario: "exclude",
+			options:  Options{Exclude: []string{"**/*.log"}},
+		},
+		{
+			scenario: "include",
+			options:  Options{Include: []string{"**/*.txt"}},
+		},
+		{
+			scenario: "ignore files",
+			options:  Options{IgnoreFiles: []string{".ignore"}},
+		},
+		{
+			scenario: "skip entry",
+			options: Options{SkipEntry: func(_ afero.Fs, src string, _ os.FileInfo, _ string, _ int) (bool, error) {
+				return strings.HasSuffix(src, ".log"), nil
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			fs := newFixtureFs(t, map[string]string{
+				"/src/a.txt":      "a",
+				"/src/.ignore":    "*.log\n",
+				"/src/dir/b.txt":  "b",
+				"/dest/x.log":     "x",
+				"/dest/dir/y.log": "y",
+				"/dest/stale.txt": "stale",
+				"/dest/dir/z.txt": "z",
+			})
+
+			opt := tc.options
+			opt.SrcFs = fs
+			opt.MirrorDest = true
+			opt.OnDirExists = mirrorAll
+
+			result, err := CopyWithResult(context.Background(), "/src", "/dest", opt)
+			require.NoError(t, err)
+
+			// The entries that would be left out of the source are kept.
+			for _, name := range []string{"/dest/x.log", "/dest/dir/y.log"} {
+				_, err := fs.Stat(name)
+				require.NoError(t, err, name)
+			}
+
+			assert.ElementsMatch(t, []string{"/dest/stale.txt", "/dest/dir/z.txt"}, result.Removed)
+		})
+	}
+}
+
+func TestOptions_OnDirExists_MirrorBackups(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, map[string]string{
+		"/src/a.txt":      "new a",
+		"/dest/a.txt":     "old a",
+		"/dest/a.txt.~1~": "older a",
+		"/dest/b.txt.~1~": "stale backup",
+		"/dest/stale.txt": "stale",
+	})
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:      fs,
+		MirrorDest: true,
+		Backup:     NumberedBackup,
+	})
+	require.NoError(t, err)
+
+	// The backups are kept, the one of this copy as the previous one.
+	assert.Equal(t, []string{"a.txt", "a.txt.~1~", "a.txt.~2~"}, dirNames(t, fs, "/dest"))
+	assert.Equal(t, []BackupEntry{{Dest: "/dest/a.txt", Backup: "/dest/a.txt.~2~"}}, result.Backups)
+	assert.ElementsMatch(t, []string{"/dest/b.txt.~1~", "/dest/stale.txt"}, result.Removed)
+
+	content, err := afero.ReadFile(fs, "/dest/a.txt.~2~")
+	require.NoError(t, err)
+	assert.Equal(t, "old a", string(content))
+}
+
+func TestOptions_OnDirExists_MirrorKeepBoth(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, map[string]string{
+		"/src/dir/a.txt":      "new a",
+		"/dest/dir/a.txt":     "old a",
+		"/dest/dir/stale.txt": "stale",
+	})
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:        fs,
+		OnDirExists:  mirrorAll,
+		OnFileExists: onFileExists(KeepBoth),
+		Concurrency:  2,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"a (1).txt", "a.txt"}, dirNames(t, fs, "/dest/dir"))
+	assert.Equal(t, []string{"/dest/dir/stale.txt"}, result.Removed)
+}
+
+// failingRemoveFs fails to remove the files.
+type failingRemoveFs struct {
+	afero.Fs
+
+	errs map[string]error
+}
+
+func (fs *failingRemoveFs) Remove(name string) error {
+	if err, ok := fs.errs[name]; ok {
+		return err
+	}
+
+	return fs.Fs.Remove(name)
+}
+
+func TestOptions_OnDirExists_MirrorRemoveError(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, mirrorFixture)
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:       fs,
+		DestFs:      &failingRemoveFs{Fs: fs, errs: map[string]error{"/dest/dir/d.txt": os.ErrPermission}},
+		MirrorDest:  true,
+		OnDirExists: mirrorAll,
+		OnError: func(*CopyError) ErrorAction {
+			return Continue
+		},
+	})
+	require.ErrorIs(t, err, os.ErrPermission)
+
+	// Only what is removed is reported.
+	assert.ElementsMatch(t, []string{"/dest/c.txt", "/dest/keep.log", "/dest/olddir"}, result.Removed)
+
+	_, err = fs.Stat("/dest/dir/d.txt")
+	require.NoError(t, err)
+}
+
+func TestPlan_Mirror(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, mirrorFixture)
+
+	ops, err := Plan("/src", "/dest", Options{
+		SrcFs:       fs,
+		MirrorDest:  true,
+		OnDirExists: mirrorAll,
+		Skip:        skipLogs,
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, ops, Operation{Type: OpRemove, Path: "/dest/c.txt"})
+	assert.Contains(t, ops, Operation{Type: OpRemove, Path: "/dest/dir/d.txt"})
+	assert.Contains(t, ops, Operation{Type: OpRemoveDir, Path: "/dest/olddir"})
+
+	_, err = fs.Stat("/dest/c.txt")
+	require.NoError(t, err)
+}
+
+// sortedByDepth keeps the paths of the same depth in order, and puts the shallower paths first.
+func sortedByDepth(paths []string) []string {
+	out := make([]string, 0, len(paths))
+
+	for depth := 0; len(out) < len(paths); depth++ {
+		for _, p := range paths {
+			if strings.Count(p, "/") == depth {
+				out = append(out, p)
+			}
+		}
+	}
+
+	return out
+}
@@ -1,7 +1,9 @@
 package aferocopy
 
 import (
+	"context"
 	"os"
+	"sync/atomic"
 
 	"github.com/spf13/afero"
 )
@@ -18,8 +20,61 @@ type Options struct {
 	OnSymlink func(srcFs afero.Fs, src string) SymlinkAction
 
 	// OnDirExists can specify what to do when there is a directory already existing in destination.
+	// It is not called for the destination itself, which is merged, or mirrored with MirrorDest.
 	OnDirExists func(srcFs afero.Fs, src string, destFs afero.Fs, dest string) DirExistsAction
 
+	// MirrorDest removes the entries of the destination itself that do not exist in the source, like OnDirExists
+	// returning Mirror does for the directories under it.
+	MirrorDest bool
+
+	// OnFileExists can specify what to do when there is a file already existing in destination.
+	OnFileExists func(srcFs afero.Fs, src string, srcInfo os.FileInfo, destFs afero.Fs, dest string, destInfo os.FileInfo) FileExistsAction
+
+	// OnSpecialFile can specify what to do with a special file, like a named pipe or a device node, when the
+	// destination cannot create it: when DestFs is neither an afero.OsFs nor a Mkfifoer, or a Mknoder for the devices,
+	// on the systems without them, or without the privileges to create devices. It is also called for the sockets and
+	// the other irregular files, which are never created nor read. By default, they are skipped.
+	OnSpecialFile func(srcFs afero.Fs, src string, info os.FileInfo) SpecialFileAction
+
+	// StagedReplace makes Replace copy into a staging directory next to the existing one first. Only when the copy
+	// succeeds, the existing directory is renamed aside, the staging one is renamed into place, and the old one is
+	// removed. So that the existing directory is left as it is if the copy fails.
+	StagedReplace bool
+
+	// SkipEntry can specify which entries should be skipped, like Skip, with what is already known about them: their
+	// info, their destination, and their depth, which is 1 for the entries of the source. It is called after Skip.
+	// Like filepath.WalkDir, it can return fs.SkipDir to skip a directory, or the rest of the parent directory when
+	// called on a file, as told by info, even through a symlink, and fs.SkipAll to stop the copy without any error.
+	// With Concurrency, the entries already being copied are not stopped.
+	SkipEntry func(srcFs afero.Fs, src string, info os.FileInfo, dest string, depth int) (bool, error)
+
+	// Include and Exclude are glob patterns of the entries to copy and to leave out, relative to the source and
+	// slash-separated, like "docs/*.md". A "**" segment matches any number of directories, like "**/*.log". An entry
+	// matching any Exclude pattern is left out, and an excluded directory is not read at all. Include only applies to
+	// the entries that are not directories: when it is not empty, they are copied only if they match any of its
+	// patterns. The directories are all created, even the ones where no file is included, use Exclude to leave them
+	// out. The source itself is always copied.
+	Include []string
+	Exclude []string
+
+	// IgnoreFiles are the names of the ignore files, like ".gitignore" or ".dockerignore". When a source directory
+	// has one, its patterns apply to the directory and below, with the semantics of .gitignore: negations, patterns
+	// anchored to the directory, and patterns only for directories. The ignore files themselves are copied.
+	IgnoreFiles []string
+
+	// MapPath can specify where each entry of the source is copied: it receives the path of the entry relative to
+	// the source, and returns the path of its destination relative to the destination, or false to skip it. The
+	// entries of a directory are mapped on their own, so a directory can be flattened or spread out. Only directories
+	// can be mapped to the same destination, where they are merged; two other entries mapped to the same destination
+	// fail. With Mirror, the extraneous entries are removed once everything is copied.
+	MapPath func(rel string, info os.FileInfo) (string, bool)
+
+	// Transform can specify how to transform the content of a file while it is copied. A nil Transformer copies it as
+	// it is. The transformed files keep the times of the source, with PreserveTimes, but not its size: their size is
+	// not compared with Update, UpdateSizeOnly copies them again, and UpdateChecksum compares the destination with the
+	// transformed source. They are not resumed from a Checkpoint either.
+	Transform func(src string, info os.FileInfo) *Transformer
+
 	// Skip can specify which files should be skipped
 	Skip func(srcFs afero.Fs, src string) (bool, error)
 
@@ -55,15 +110,128 @@ type Options struct {
 	// Preserve the uid and the gid of all entries.
 	PreserveOwner bool
 
+	// PreserveHardLinks links the files that are hard links to the same file in the source to the same file in the
+	// destination, instead of copying it again, if DestFs is an afero.OsFs or a HardLinker. They are copied when the
+	// destination cannot link them, like across devices, and the other errors of the links fail like the ones of a
+	// copy.
+	PreserveHardLinks bool
+
+	// Update can specify how to decide whether a file is up to date in the destination, so that it is not copied
+	// again. By default, every file is copied. UpdateSizeAndModTime needs PreserveTimes to skip anything.
+	Update UpdateMode
+
+	// Atomic writes every file into a temporary file next to the destination, with its permission, owner and times,
+	// then renames it over the destination. So that the destination is never seen half-written. The temporary file is
+	// removed on failure.
+	Atomic bool
+
+	// Backup can specify how to back up the existing destination files before overwriting them, by renaming them.
+	// With Atomic, they are hard linked, or copied, instead, so that they stay in place until they are replaced.
+	// By default, they are overwritten without any backup.
+	Backup BackupMode
+
+	// BackupSuffix is the suffix of the backups with SimpleBackup, "~" by default.
+	BackupSuffix string
+
+	// MaxBackups is the maximum number of backups kept for a file with NumberedBackup, the oldest ones are removed.
+	// Zero keeps all of them.
+	MaxBackups int
+
+	// Transactional journals every change to the destination, and rolls all of them back if the copy fails or is
+	// canceled, even with the errors OnError continues on. The entries that are replaced or removed are moved aside,
+	// next to the destination, until the copy ends.
+	Transactional bool
+
+	// Checkpoint is the path of a journal that records the entries copied, and how far the files are copied. So that,
+	// when the copy stops, a next copy of the same source to the same destination with the same journal resumes from
+	// where it stopped: the entries already copied are skipped, and the files partially copied are appended to, after
+	// checking that they start like the source. The journal is removed once the copy succeeds. It should not be in the
+	// destination. Files are not resumed with Atomic.
+	Checkpoint string
+
+	// CheckpointFs is the filesystem of the Checkpoint journal, DestFs by default.
+	CheckpointFs afero.Fs
+
+	// Sparse keeps the holes of the sparse files, like the disk images, instead of writing them as zeros: the
+	// destination seeks over them, and is truncated to the size of the source at the end. The holes are found with
+	// SEEK_DATA and SEEK_HOLE when the source is an *os.File that supports them, or as blocks of zeros otherwise.
+	Sparse bool
+
+	// FastCopy copies the content of the files in the kernel when both of them are files of the host, like with
+	// afero.OsFs or an afero.BasePathFs over it, on linux: with a reflink, that shares the content on the filesystems
+	// that support copy on write, or with copy_file_range. It falls back to copying through a buffer when they cannot,
+	// or with Transform. With Sparse, only reflinks are used. Progress.Strategy and Result.Strategies tell how the
+	// files are copied.
+	FastCopy bool
+
 	// The byte size of the buffer to use for copying files.
 	// If zero, the internal default buffer of 32KB is used.
 	// See https://golang.org/pkg/io/#CopyBuffer for more information.
 	CopyBufferSize uint
 
+	// Concurrency is the maximum number of files copied at the same time.
+	// Directories are still walked one by one, and the permission, the owner and the times of a directory are only
+	// applied after all of its entries are copied. Zero or one copies everything sequentially. With more, every
+	// callback but OnProgress, like Skip, SkipEntry, OnSymlink, OnDirExists, OnFileExists, OnError, MapPath and
+	// Transform, may be called from several goroutines at the same time, and must be safe for it.
+	Concurrency int
+
+	// OnError can specify what to do when an entry fails to be copied. By default, the copy is aborted.
+	// When it continues, the errors are joined and returned at the end of the copy. The copy is always aborted when
+	// the context is done.
+	OnError func(err *CopyError) ErrorAction
+
+	// OnProgress is called with the progress of the copy: when an entry starts and finishes being copied, and
+	// periodically while the content of a file is being copied. It is never called concurrently.
+	OnProgress func(p Progress)
+
+	// PreScan walks the source before copying, so that the total number of entries and bytes are known in the
+	// progress reports. It is only useful with OnProgress. The pre-scan only applies Include, Exclude and
+	// IgnoreFiles, and calls none of the callbacks, so that each of them is called once per entry, by the copy.
+	PreScan bool
+
 	intent struct {
 		src  string
 		dest string
 	}
+
+	// rel is the path of the entry being copied, relative to the source.
+	rel string
+
+	// ignores are the rules of the ignore files found on the way to the entry being copied.
+	ignores []ignoreFile
+
+	// stopped is set when Options.SkipEntry stops the copy.
+	stopped *atomic.Bool
+
+	// mapper records the destinations of Options.MapPath.
+	mapper *pathMapper
+
+	// mapped is set when the destination of the entry comes from Options.MapPath, and is not claimed yet.
+	mapped bool
+
+	// written records the destinations that Mirror keeps, although they are not in the source.
+	written *writtenPaths
+
+	// backups is the numbered backups in the destination directories, read once per directory.
+	backups *backupIndex
+
+	// transform is the Options.Transform of the file being copied.
+	transform *Transformer
+
+	// links tracks the hard links of the source, with Options.PreserveHardLinks.
+	links *linkTracker
+
+	// linked is the file being copied, when the other hard links of its source are linked to it.
+	linked *linkedFile
+
+	ctx        context.Context //nolint: containedctx
+	progress   *progressTracker
+	pool       *workerPool
+	planning   bool
+	result     *resultCollector
+	failures   *errorCollector
+	checkpoint *checkpoint
 }
 
 // SymlinkAction represents what to do on symlink.
@@ -88,6 +256,12 @@ const (
 	Replace
 	// Untouchable does nothing for the dir, and leaves it as it is.
 	Untouchable
+	// Mirror preserves or overwrites existing files under the dir, like Merge, then removes the entries that do not
+	// exist in src. The entries that the copy would leave out if they were in src are kept: the ones that
+	// Options.Exclude, Options.Include, Options.IgnoreFiles, Options.Skip or Options.SkipEntry leave out, which are
+	// called with the info of the entry in the destination. The files that the copy writes next to the others, and the
+	// backups of the files of src, with Options.Backup, are kept too.
+	Mirror
 )
 
 // getDefaultOptions provides default options,
@@ -106,10 +280,14 @@ func getDefaultOptions(src, dest string) Options {
 		Sync:              false,              // Do not sync
 		PreserveTimes:     false,              // Do not preserve the modification time
 		CopyBufferSize:    0,                  // Do not specify, use default bufsize (32*1024)
+		BackupSuffix:      defaultBackupSuffix,
 		intent: struct {
 			src  string
 			dest string
 		}{src, dest},
+		ctx:     context.Background(),
+		stopped: new(atomic.Bool),
+		written: newWrittenPaths(),
 	}
 }
 
@@ -140,6 +318,26 @@ func assureOptions(src, dest string, opts ...Options) Options {
 		opts[0].Skip = defaults.Skip
 	}
 
+	if opts[0].CheckpointFs == nil {
+		opts[0].CheckpointFs = opts[0].DestFs
+	}
+
+	if opts[0].BackupSuffix == "" {
+		opts[0].BackupSuffix = defaults.BackupSuffix
+	}
+
+	if opts[0].MapPath != nil {
+		opts[0].mapper = newPathMapper()
+	}
+
+	if opts[0].PreserveHardLinks {
+		opts[0].links = newLinkTracker()
+	}
+
+	if opts[0].Backup == NumberedBackup {
+		opts[0].backups = newBackupIndex()
+	}
+
 	if opts[0].AddPermission > 0 {
 		opts[0].PermissionControl = AddPermission(opts[0].AddPermission)
 	} else if opts[0].PermissionControl == nil {
@@ -148,6 +346,9 @@ func assureOptions(src, dest string, opts ...Options) Options {
 
 	opts[0].intent.src = defaults.intent.src
 	opts[0].intent.dest = defaults.intent.dest
+	opts[0].ctx = defaults.ctx
+	opts[0].stopped = defaults.stopped
+	opts[0].written = defaults.written
 
 	return opts[0]
 }
@@ -18,7 +18,7 @@ func TestCopy_PathError(t *testing.T) {
 		err := Copy("resources/fixtures/data/case00", filepath.Join("resources/test/data/case00", dest))
 
 		require.Error(t, err)
-		assert.IsType(t, &os.PathError{}, err)
+		assertDestPathError(t, err)
 	})
 
 	t.Run("try to create not permitted location", func(t *testing.T) {
@@ -29,13 +29,26 @@ func TestCopy_PathError(t *testing.T) {
 		err := Copy("resources/fixtures/data/case00", "/case00")
 
 		require.Error(t, err)
-		assert.IsType(t, &os.PathError{}, err)
+		assertDestPathError(t, err)
 	})
 
 	t.Run("try to create a directory on existing file name", func(t *testing.T) {
 		err := Copy("resources/fixtures/data/case02", "resources/test/data.copy/case00/README.md")
 
 		require.Error(t, err)
-		assert.IsType(t, &os.PathError{}, err)
+		assertDestPathError(t, err)
 	})
 }
+
+func assertDestPathError(t *testing.T, err error) {
+	t.Helper()
+
+	var (
+		copyErr *CopyError
+		pathErr *os.PathError
+	)
+
+	require.ErrorAs(t, err, &copyErr)
+	assert.Equal(t, DestSide, copyErr.Fs)
+	assert.ErrorAs(t, err, &pathErr)
+}
@@ -0,0 +1,614 @@
+package aferocopy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/mem"
+)
+
+// OperationType is the type of an operation on the destination filesystem.
+type OperationType int
+
+const (
+	// OpMkdir creates a directory.
+	OpMkdir OperationType = iota
+	// OpCreateFile creates, or truncates, a file and writes the content of the source to it.
+	OpCreateFile
+	// OpSymlink creates a symlink.
+	OpSymlink
+	// OpMkfifo creates a named pipe.
+	OpMkfifo
+	// OpRemoveDir removes a directory and everything under it.
+	OpRemoveDir
+	// OpRemove removes a file or an empty directory.
+	OpRemove
+	// OpRename renames an entry.
+	OpRename
+	// OpChmod changes the permission of an entry.
+	OpChmod
+	// OpChown changes the owner of an entry.
+	OpChown
+	// OpChtimes changes the access and the modification times of an entry.
+	OpChtimes
+	// OpLink creates a hard link.
+	OpLink
+	// OpMknod creates a device node.
+	OpMknod
+)
+
+var operationTypes = map[OperationType]string{
+	OpMkdir:      "mkdir",
+	OpCreateFile: "create",
+	OpSymlink:    "symlink",
+	OpMkfifo:     "mkfifo",
+	OpRemoveDir:  "removeall",
+	OpRemove:     "remove",
+	OpRename:     "rename",
+	OpChmod:      "chmod",
+	OpChown:      "chown",
+	OpChtimes:    "chtimes",
+	OpLink:       "link",
+	OpMknod:      "mknod",
+}
+
+// String returns the name of the operation type.
+func (t OperationType) String() string {
+	if s, ok := operationTypes[t]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("OperationType(%d)", int(t))
+}
+
+// Operation is an operation that Copy would do on the destination filesystem.
+type Operation struct {
+	// Type is the type of the operation.
+	Type OperationType
+
+	// Path is the path of the entry in the destination filesystem.
+	Path string
+
+	// Target is the target of the symlink, for OpSymlink, the new path of the entry, for OpRename, or the file linked
+	// to, for OpLink.
+	Target string
+
+	// Mode is the mode of the entry, for OpMkdir, OpMkfifo, OpMknod and OpChmod.
+	Mode os.FileMode
+
+	// Dev is the device number, for OpMknod.
+	Dev uint64
+
+	// UID and GID are the owner of the entry, for OpChown.
+	UID int
+	GID int
+
+	// Atime and Mtime are the times of the entry, for OpChtimes.
+	Atime time.Time
+	Mtime time.Time
+}
+
+// String returns a human-readable form of the operation.
+func (o Operation) String() string {
+	switch o.Type {
+	case OpSymlink, OpRename, OpLink:
+		return fmt.Sprintf("%s %s -> %s", o.Type, o.Path, o.Target)
+
+	case OpMkdir, OpMkfifo, OpChmod:
+		return fmt.Sprintf("%s %s %s", o.Type, o.Path, o.Mode)
+
+	case OpMknod:
+		return fmt.Sprintf("%s %s %s %d", o.Type, o.Path, o.Mode, o.Dev)
+
+	case OpChown:
+		return fmt.Sprintf("%s %s %d:%d", o.Type, o.Path, o.UID, o.GID)
+
+	case OpChtimes:
+		return fmt.Sprintf("%s %s %s", o.Type, o.Path, o.Mtime.Format(time.RFC3339Nano))
+
+	default:
+		return fmt.Sprintf("%s %s", o.Type, o.Path)
+	}
+}
+
+// Plan walks src exactly as Copy would, with the same options, and returns the operations that Copy would do on the
+// destination filesystem, in order. The destination filesystem is only read, never changed.
+//
+// The operations planned before an error are returned along with the error.
+func Plan(src, dest string, opt ...Options) ([]Operation, error) {
+	o := assureOptions(src, dest, opt...)
+
+	if err := checkPatterns(o); err != nil {
+		return nil, err
+	}
+
+	info, err := stat(o.SrcFs, src)
+	if err != nil {
+		return nil, srcError("lstat", src, dest, err)
+	}
+
+	fs := newPlanFs(o.DestFs)
+	err = walk(src, dest, info, o.dryRun(fs))
+
+	return fs.operations(), err
+}
+
+// dryRun returns the options to walk the source without touching the destination.
+func (o Options) dryRun(fs *planFs) Options {
+	o.DestFs = fs.fs()
+	o.planning = true
+	o.progress = nil
+	o.pool = nil
+	o.result = nil
+	o.checkpoint = o.checkpoint.readOnly()
+	o.stopped = new(atomic.Bool)
+	o.written = newWrittenPaths()
+
+	if o.mapper != nil {
+		o.mapper = newPathMapper()
+	}
+
+	if o.links != nil {
+		o.links = newLinkTracker()
+	}
+
+	if o.backups != nil {
+		o.backups = newBackupIndex()
+	}
+
+	return o
+}
+
+// planFs records the changes to the base filesystem instead of doing them.
+// The changes are remembered, so that the next calls see them as if they were done.
+type planFs struct {
+	base afero.Fs
+
+	mu      sync.Mutex
+	ops     []Operation
+	created map[string]*mem.FileData
+	removed []string
+}
+
+var (
+	_ afero.Fs        = (*planFs)(nil)
+	_ afero.Lstater   = (*planFs)(nil)
+	_ afero.Symlinker = (*planSymlinkFs)(nil)
+	_ Mkfifoer        = (*planFs)(nil)
+	_ Mknoder         = (*planFs)(nil)
+	_ HardLinker      = (*planFs)(nil)
+)
+
+func newPlanFs(base afero.Fs) *planFs {
+	return &planFs{
+		base:    base,
+		created: make(map[string]*mem.FileData),
+	}
+}
+
+// fs returns the filesystem that supports symlinks only if the base one does.
+func (fs *planFs) fs() afero.Fs {
+	if _, ok := fs.base.(afero.Symlinker); ok {
+		return &planSymlinkFs{planFs: fs}
+	}
+
+	return fs
+}
+
+func (fs *planFs) operations() []Operation {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return append([]Operation(nil), fs.ops...)
+}
+
+func (fs *planFs) record(op Operation) {
+	fs.ops = append(fs.ops, op)
+}
+
+func (fs *planFs) isRemoved(name string) bool {
+	for _, r := range fs.removed {
+		if name == r || strings.HasPrefix(name, r+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lstat must be called with the lock held.
+func (fs *planFs) lstat(name string) (os.FileInfo, error) {
+	name = filepath.Clean(name)
+
+	if f, ok := fs.created[name]; ok {
+		return mem.GetFileInfo(f), nil
+	}
+
+	if fs.isRemoved(name) {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+
+	return stat(fs.base, name)
+}
+
+// create must be called with the lock held.
+func (fs *planFs) create(name string, mode os.FileMode) *mem.FileData {
+	name = filepath.Clean(name)
+
+	var f *mem.FileData
+
+	if mode.IsDir() {
+		f = mem.CreateDir(name)
+	} else {
+		f = mem.CreateFile(name)
+	}
+
+	mem.SetMode(f, mode)
+
+	fs.created[name] = f
+
+	return f
+}
+
+// checkParent must be called with the lock held.
+func (fs *planFs) checkParent(op, name string) error {
+	parent, err := fs.lstat(filepath.Dir(name))
+	if err != nil {
+		return &os.PathError{Op: op, Path: name, Err: syscall.ENOENT}
+	}
+
+	if !parent.IsDir() {
+		return &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+
+	return nil
+}
+
+func (fs *planFs) Create(name string) (afero.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if info, err := fs.lstat(name); err == nil && info.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+
+	if err := fs.checkParent("open", name); err != nil {
+		return nil, err
+	}
+
+	fs.record(Operation{Type: OpCreateFile, Path: name})
+
+	return mem.NewFileHandle(fs.create(name, 0o666)), nil
+}
+
+func (fs *planFs) Mkdir(name string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := fs.lstat(name); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+
+	if err := fs.checkParent("mkdir", name); err != nil {
+		return err
+	}
+
+	fs.record(Operation{Type: OpMkdir, Path: name, Mode: perm})
+	fs.create(name, os.ModeDir|perm)
+
+	return nil
+}
+
+func (fs *planFs) MkdirAll(path string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var missing []string
+
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		info, err := fs.lstat(p)
+		if err == nil {
+			if !info.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+			}
+
+			break
+		}
+
+		missing = append(missing, p)
+
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		fs.record(Operation{Type: OpMkdir, Path: missing[i], Mode: perm})
+		fs.create(missing[i], os.ModeDir|perm)
+	}
+
+	return nil
+}
+
+func (fs *planFs) Open(name string) (afero.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	name = filepath.Clean(name)
+
+	if f, ok := fs.created[name]; ok {
+		return mem.NewReadOnlyFileHandle(f), nil
+	}
+
+	if fs.isRemoved(name) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	return fs.base.Open(name)
+}
+
+func (fs *planFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return fs.Open(name)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	info, err := fs.lstat(name)
+
+	switch {
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+
+	case err == nil && info.IsDir():
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+
+	case err != nil && flag&os.O_CREATE == 0:
+		return nil, err
+	}
+
+	if err := fs.checkParent("open", name); err != nil {
+		return nil, err
+	}
+
+	fs.record(Operation{Type: OpCreateFile, Path: name})
+
+	return mem.NewFileHandle(fs.create(name, perm)), nil
+}
+
+func (fs *planFs) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := fs.lstat(name); err != nil {
+		return err
+	}
+
+	fs.record(Operation{Type: OpRemove, Path: name})
+	fs.forget(name)
+
+	return nil
+}
+
+func (fs *planFs) RemoveAll(path string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := fs.lstat(path); err != nil {
+		return nil //nolint: nilerr // Like os.RemoveAll, removing a missing path is not an error.
+	}
+
+	fs.record(Operation{Type: OpRemoveDir, Path: path})
+	fs.forget(path)
+
+	return nil
+}
+
+// forget must be called with the lock held.
+func (fs *planFs) forget(path string) {
+	path = filepath.Clean(path)
+
+	for name := range fs.created {
+		if name == path || strings.HasPrefix(name, path+string(filepath.Separator)) {
+			delete(fs.created, name)
+		}
+	}
+
+	fs.removed = append(fs.removed, path)
+}
+
+func (fs *planFs) Rename(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	info, err := fs.lstat(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+
+	if existing, err := fs.lstat(newname); err == nil && existing.IsDir() && !info.IsDir() {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EISDIR}
+	}
+
+	if err := fs.checkParent("rename", newname); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.ENOENT}
+	}
+
+	fs.record(Operation{Type: OpRename, Path: oldname, Target: newname})
+	fs.forget(oldname)
+	fs.forget(newname)
+	fs.create(newname, info.Mode())
+
+	return nil
+}
+
+func (fs *planFs) Stat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	info, err := fs.lstat(name)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return info, err
+	}
+
+	return fs.base.Stat(name)
+}
+
+func (fs *planFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	info, err := fs.lstat(name)
+
+	return info, true, err
+}
+
+func (fs *planFs) Name() string {
+	return "PlanFs"
+}
+
+func (fs *planFs) Chmod(name string, mode os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := fs.lstat(name); err != nil {
+		return err
+	}
+
+	fs.record(Operation{Type: OpChmod, Path: name, Mode: mode})
+
+	return nil
+}
+
+func (fs *planFs) Chown(name string, uid, gid int) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := fs.lstat(name); err != nil {
+		return err
+	}
+
+	fs.record(Operation{Type: OpChown, Path: name, UID: uid, GID: gid})
+
+	return nil
+}
+
+func (fs *planFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := fs.lstat(name); err != nil {
+		return err
+	}
+
+	fs.record(Operation{Type: OpChtimes, Path: name, Atime: atime, Mtime: mtime})
+
+	return nil
+}
+
+func (fs *planFs) MkfifoIfPossible(name string, mode os.FileMode) error {
+	if !canMkfifo(fs.base) {
+		return &os.PathError{Op: "mkfifo", Path: name, Err: errors.ErrUnsupported}
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := fs.lstat(name); err == nil {
+		return &os.PathError{Op: "mkfifo", Path: name, Err: os.ErrExist}
+	}
+
+	if err := fs.checkParent("mkfifo", name); err != nil {
+		return err
+	}
+
+	fs.record(Operation{Type: OpMkfifo, Path: name, Mode: mode})
+	fs.create(name, os.ModeNamedPipe|mode.Perm())
+
+	return nil
+}
+
+func (fs *planFs) MknodIfPossible(name string, mode os.FileMode, dev uint64) error {
+	if !canMknod(fs.base) {
+		return &os.PathError{Op: "mknod", Path: name, Err: errors.ErrUnsupported}
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := fs.lstat(name); err == nil {
+		return &os.PathError{Op: "mknod", Path: name, Err: os.ErrExist}
+	}
+
+	if err := fs.checkParent("mknod", name); err != nil {
+		return err
+	}
+
+	fs.record(Operation{Type: OpMknod, Path: name, Mode: mode, Dev: dev})
+	fs.create(name, mode&(os.ModeDevice|os.ModeCharDevice)|mode.Perm())
+
+	return nil
+}
+
+func (fs *planFs) LinkIfPossible(oldname, newname string) error {
+	if !canLink(fs.base) {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrNoHardLink}
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	info, err := fs.lstat(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+
+	if _, err := fs.lstat(newname); err == nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+
+	if err := fs.checkParent("link", newname); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.ENOENT}
+	}
+
+	fs.record(Operation{Type: OpLink, Path: newname, Target: oldname})
+	fs.create(newname, info.Mode())
+
+	return nil
+}
+
+// planSymlinkFs is a planFs over a filesystem that supports symlinks.
+type planSymlinkFs struct {
+	*planFs
+}
+
+func (fs *planSymlinkFs) SymlinkIfPossible(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := fs.lstat(newname); err == nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+
+	if err := fs.checkParent("symlink", newname); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.ENOENT}
+	}
+
+	fs.record(Operation{Type: OpSymlink, Path: newname, Target: oldname})
+	fs.create(newname, os.ModeSymlink|os.ModePerm)
+
+	return nil
+}
+
+func (fs *planSymlinkFs) ReadlinkIfPossible(name string) (string, error) {
+	return fs.base.(afero.Symlinker).ReadlinkIfPossible(name) //nolint: errcheck,forcetypeassert
+}
@@ -0,0 +1,174 @@
+package aferocopy
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// planFixture is a source, and a destination that already has one of its directories.
+var planFixture = map[string]string{
+	"/src/a.txt":      "a",
+	"/src/dir/b.txt":  "b",
+	"/dest/dir/c.txt": "c",
+}
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, planFixture)
+	require.NoError(t, fs.Chmod("/src/dir/b.txt", 0o600))
+
+	ops, err := Plan("/src", "/target", Options{SrcFs: fs})
+	require.NoError(t, err)
+
+	expected := []Operation{
+		{Type: OpMkdir, Path: "/target", Mode: tmpPermissionForDirectory},
+		{Type: OpCreateFile, Path: "/target/a.txt"},
+		{Type: OpChmod, Path: "/target/a.txt", Mode: 0o644},
+		{Type: OpMkdir, Path: "/target/dir", Mode: tmpPermissionForDirectory},
+		{Type: OpCreateFile, Path: "/target/dir/b.txt"},
+		{Type: OpChmod, Path: "/target/dir/b.txt", Mode: 0o600},
+		{Type: OpChmod, Path: "/target/dir", Mode: os.ModeDir | 0o755},
+		{Type: OpChmod, Path: "/target", Mode: os.ModeDir | 0o755},
+	}
+
+	assert.Equal(t, expected, ops)
+
+	_, err = fs.Stat("/target")
+	assert.True(t, os.IsNotExist(err), "destination must not be touched")
+}
+
+func TestPlan_OnDirExists(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		action   DirExistsAction
+		expected []Operation
+	}{
+		{
+			scenario: "replace",
+			action:   Replace,
+			expected: []Operation{
+				{Type: OpCreateFile, Path: "/dest/a.txt"},
+				{Type: OpChmod, Path: "/dest/a.txt", Mode: 0o644},
+				{Type: OpRemoveDir, Path: "/dest/dir"},
+				{Type: OpMkdir, Path: "/dest/dir", Mode: tmpPermissionForDirectory},
+				{Type: OpCreateFile, Path: "/dest/dir/b.txt"},
+				{Type: OpChmod, Path: "/dest/dir/b.txt", Mode: 0o600},
+				{Type: OpChmod, Path: "/dest/dir", Mode: os.ModeDir | 0o755},
+				{Type: OpChmod, Path: "/dest", Mode: os.ModeDir | 0o755},
+			},
+		},
+		{
+			scenario: "untouchable",
+			action:   Untouchable,
+			expected: []Operation{
+				{Type: OpCreateFile, Path: "/dest/a.txt"},
+				{Type: OpChmod, Path: "/dest/a.txt", Mode: 0o644},
+				{Type: OpChmod, Path: "/dest", Mode: os.ModeDir | 0o755},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			fs := newFixtureFs(t, planFixture)
+			require.NoError(t, fs.Chmod("/src/dir/b.txt", 0o600))
+
+			ops, err := Plan("/src", "/dest", Options{
+				SrcFs: fs,
+				OnDirExists: func(afero.Fs, string, afero.Fs, string) DirExistsAction {
+					return tc.action
+				},
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, ops)
+
+			content, err := afero.ReadFile(fs, "/dest/dir/c.txt")
+			require.NoError(t, err)
+			assert.Equal(t, "c", string(content))
+		})
+	}
+}
+
+func TestPlan_Error(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, planFixture)
+
+	require.NoError(t, afero.WriteFile(fs, "/file", nil, 0o644))
+
+	ops, err := Plan("/src", "/file/dest", Options{SrcFs: fs})
+
+	require.Error(t, err)
+	assert.Empty(t, ops)
+}
+
+func TestPlan_MissingSource(t *testing.T) {
+	t.Parallel()
+
+	ops, err := Plan("/missing", "/dest", Options{SrcFs: afero.NewMemMapFs()})
+	require.ErrorIs(t, err, os.ErrNotExist)
+	assert.Empty(t, ops)
+
+	// The error is the one Copy returns.
+	var copyErr *CopyError
+
+	require.ErrorAs(t, err, &copyErr)
+	assert.Equal(t, "lstat", copyErr.Op)
+	assert.Equal(t, SrcSide, copyErr.Fs)
+	assert.Equal(t, "/missing", copyErr.Src)
+	assert.Equal(t, "/dest", copyErr.Dest)
+	assert.Equal(t, Copy("/missing", "/dest", Options{SrcFs: afero.NewMemMapFs()}).Error(), err.Error())
+}
+
+func TestPlan_Symlink(t *testing.T) {
+	ops, err := Plan("resources/fixtures/data/case03", "resources/test/data.copy/case03.plan")
+	require.NoError(t, err)
+
+	assert.Contains(t, ops, Operation{
+		Type:   OpSymlink,
+		Path:   "resources/test/data.copy/case03.plan/case01",
+		Target: "resources/fixtures/data/case01",
+	})
+
+	_, err = os.Stat("resources/test/data.copy/case03.plan")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPlan_NamedPipe(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "js" {
+		t.Skip("See https://github.com/otiai10/copy/issues/47")
+	}
+
+	ops, err := Plan("resources/fixtures/data/case11", "resources/test/data.copy/case11.plan")
+	require.NoError(t, err)
+
+	assert.Contains(t, ops, Operation{
+		Type: OpMkfifo,
+		Path: "resources/test/data.copy/case11.plan/foo/bar",
+		Mode: os.ModeNamedPipe | 0o555,
+	})
+
+	_, err = os.Stat("resources/test/data.copy/case11.plan")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOperation_String(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "mkdir /dest -rwxr-xr-x", Operation{Type: OpMkdir, Path: "/dest", Mode: 0o755}.String())
+	assert.Equal(t, "symlink /dest/a -> b", Operation{Type: OpSymlink, Path: "/dest/a", Target: "b"}.String())
+	assert.Equal(t, "chown /dest 1:2", Operation{Type: OpChown, Path: "/dest", UID: 1, GID: 2}.String())
+	assert.Equal(t, "removeall /dest", Operation{Type: OpRemoveDir, Path: "/dest"}.String())
+	assert.Equal(t, "OperationType(42)", OperationType(42).String())
+}
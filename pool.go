@@ -0,0 +1,132 @@
+package aferocopy
+
+import (
+	"context"
+	"sync"
+)
+
+// workerPool bounds the number of files copied at the same time.
+// A nil pool copies everything sequentially.
+type workerPool struct {
+	slots chan struct{}
+}
+
+func newWorkerPool(concurrency int) *workerPool {
+	if concurrency <= 1 {
+		return nil
+	}
+
+	return &workerPool{slots: make(chan struct{}, concurrency)}
+}
+
+// group runs the copy of the entries of a directory, some of them in the worker pool.
+// The first error cancels the context of the group, so that no more entry is started and the entries in progress
+// stop as soon as possible.
+type group struct {
+	pool   *workerPool
+	parent context.Context //nolint: containedctx
+	ctx    context.Context //nolint: containedctx
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	next int
+	errs map[int]error
+}
+
+func newGroup(ctx context.Context, pool *workerPool) *group {
+	gctx, cancel := context.WithCancel(ctx)
+
+	return &group{
+		pool:   pool,
+		parent: ctx,
+		ctx:    gctx,
+		cancel: cancel,
+		errs:   make(map[int]error),
+	}
+}
+
+// Go runs f in the worker pool if async is true and there is a pool, otherwise it runs f right away.
+// f is not run at all if the group has been canceled.
+func (g *group) Go(async bool, f func() error) {
+	if g.ctx.Err() != nil {
+		return
+	}
+
+	i := g.next
+	g.next++
+
+	if !async || g.pool == nil {
+		g.record(i, f())
+
+		return
+	}
+
+	select {
+	case g.pool.slots <- struct{}{}:
+	case <-g.ctx.Done():
+		return
+	}
+
+	g.wg.Add(1)
+
+	go func() {
+		defer g.wg.Done()
+		defer func() { <-g.pool.slots }()
+
+		g.record(i, f())
+	}()
+}
+
+func (g *group) record(i int, err error) {
+	if err == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.errs[i] = err
+
+	g.cancel()
+}
+
+// Wait waits for all the entries in progress, and returns the error of the first entry, in the order they were
+// started, that failed on its own and not because the group was canceled.
+func (g *group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var (
+		first    error
+		firstOwn error
+	)
+
+	for i := 0; i < g.next; i++ {
+		err, ok := g.errs[i]
+		if !ok {
+			continue
+		}
+
+		if first == nil {
+			first = err
+		}
+
+		if g.parent.Err() == nil && isContextError(err) {
+			continue
+		}
+
+		firstOwn = err
+
+		break
+	}
+
+	if firstOwn != nil {
+		return firstOwn
+	}
+
+	return first
+}
@@ -0,0 +1,147 @@
+package aferocopy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// journalFs records the files created and the paths chmod-ed in the destination.
+type journalFs struct {
+	afero.Fs
+
+	mu      sync.Mutex
+	journal []string
+}
+
+func (fs *journalFs) record(op, name string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.journal = append(fs.journal, op+" "+name)
+}
+
+func (fs *journalFs) Create(name string) (afero.File, error) {
+	fs.record("create", name)
+
+	return fs.Fs.Create(name)
+}
+
+func (fs *journalFs) Chmod(name string, mode os.FileMode) error {
+	fs.record("chmod", name)
+
+	return fs.Fs.Chmod(name, mode)
+}
+
+// failingOpenFs fails to open the given files.
+type failingOpenFs struct {
+	afero.Fs
+
+	errs map[string]error
+}
+
+func (fs *failingOpenFs) Open(name string) (afero.File, error) {
+	if err, ok := fs.errs[name]; ok {
+		return nil, err
+	}
+
+	return fs.Fs.Open(name)
+}
+
+func TestOptions_Concurrency(t *testing.T) {
+	t.Parallel()
+
+	srcFs := afero.NewMemMapFs()
+
+	for d := 0; d < 5; d++ {
+		for f := 0; f < 20; f++ {
+			name := fmt.Sprintf("/src/dir%d/file%02d.txt", d, f)
+
+			require.NoError(t, afero.WriteFile(srcFs, name, []byte(name), 0o644))
+		}
+	}
+
+	destFs := &journalFs{Fs: afero.NewMemMapFs()}
+
+	err := Copy("/src", "/dest", Options{SrcFs: srcFs, DestFs: destFs, Concurrency: 8})
+	require.NoError(t, err)
+
+	for d := 0; d < 5; d++ {
+		dir := fmt.Sprintf("/dest/dir%d", d)
+		chmodAt := -1
+		lastCreateAt := -1
+
+		for i, entry := range destFs.journal {
+			switch {
+			case entry == "chmod "+dir:
+				chmodAt = i
+
+			case entry[:6] == "create" && filepath.Dir(entry[7:]) == dir:
+				lastCreateAt = i
+			}
+		}
+
+		assert.Greater(t, chmodAt, lastCreateAt, "permission of %s must be applied after all of its files", dir)
+
+		for f := 0; f < 20; f++ {
+			name := fmt.Sprintf("dir%d/file%02d.txt", d, f)
+
+			content, err := afero.ReadFile(destFs, "/dest/"+name)
+			require.NoError(t, err)
+			assert.Equal(t, "/src/"+name, string(content))
+		}
+	}
+}
+
+func TestOptions_Concurrency_Error(t *testing.T) {
+	t.Parallel()
+
+	srcFs := afero.NewMemMapFs()
+
+	for f := 0; f < 50; f++ {
+		name := fmt.Sprintf("/src/file%02d.txt", f)
+
+		require.NoError(t, afero.WriteFile(srcFs, name, []byte(name), 0o644))
+	}
+
+	for i := 0; i < 10; i++ {
+		err := Copy("/src", fmt.Sprintf("/dest%d", i), Options{
+			SrcFs: &failingOpenFs{Fs: srcFs, errs: map[string]error{
+				"/src/file10.txt": errors.New("file10"),
+				"/src/file11.txt": errors.New("file11"),
+				"/src/file40.txt": errors.New("file40"),
+			}},
+			DestFs:      afero.NewMemMapFs(),
+			Concurrency: 4,
+		})
+
+		var copyErr *CopyError
+
+		require.ErrorAs(t, err, &copyErr)
+		assert.Equal(t, "/src/file10.txt", copyErr.Src)
+		assert.EqualError(t, copyErr.Err, "file10")
+	}
+}
+
+func TestGroup_Sequential(t *testing.T) {
+	t.Parallel()
+
+	g := newGroup(context.Background(), nil)
+
+	var calls int
+
+	g.Go(true, func() error { calls++; return nil })
+	g.Go(true, func() error { calls++; return errors.New("error") })
+	g.Go(true, func() error { calls++; return nil })
+
+	require.EqualError(t, g.Wait(), "error")
+	assert.Equal(t, 2, calls)
+}
@@ -25,3 +25,12 @@ func preserveOwner(srcFs afero.Fs, src string, destFs afero.Fs, dest string, inf
 
 	return nil
 }
+
+// fileOwner returns the owner of the entry, if the filesystem tells it.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(stat.Uid), int(stat.Gid), true
+	}
+
+	return 0, 0, false
+}
@@ -12,3 +12,7 @@ import (
 func preserveOwner(srcFs afero.Fs, src string, destFs afero.Fs, dest string, info os.FileInfo) (err error) {
 	return nil
 }
+
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
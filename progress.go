@@ -0,0 +1,236 @@
+package aferocopy
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// ProgressEvent represents what a progress report is about.
+type ProgressEvent int
+
+const (
+	// EntryStarted is reported when an entry starts being copied.
+	EntryStarted ProgressEvent = iota
+	// EntryFinished is reported when an entry is copied, or fails to be copied.
+	EntryFinished
+	// BytesCopied is reported periodically while the content of a file is being copied.
+	BytesCopied
+)
+
+// Progress is a report of the copy progress.
+type Progress struct {
+	// Event tells what the report is about.
+	Event ProgressEvent
+
+	// Src and Dest are the paths of the entry being copied.
+	Src  string
+	Dest string
+
+	// Info is the file info of the source entry.
+	Info os.FileInfo
+
+	// Bytes is the number of bytes of the entry copied so far. Only set for BytesCopied events.
+	Bytes int64
+
+	// Strategy is how the content of the file is copied, see Options.FastCopy. Only set for BytesCopied events.
+	Strategy CopyStrategy
+
+	// Err is the error that the entry fails with. Only set for EntryFinished events.
+	Err error
+
+	// CopiedEntries and CopiedBytes are the number of entries and bytes copied so far.
+	CopiedEntries int64
+	CopiedBytes   int64
+
+	// TotalEntries and TotalBytes are the number of entries and bytes to copy.
+	// They are only known when Options.PreScan is enabled, otherwise they are -1. They count what Options.Include,
+	// Options.Exclude and Options.IgnoreFiles leave of the source, so they are more than what is copied when the
+	// callbacks skip entries.
+	TotalEntries int64
+	TotalBytes   int64
+}
+
+// progressTracker keeps the counters of the copy and reports them to Options.OnProgress.
+// A nil tracker reports nothing.
+type progressTracker struct {
+	mu         sync.Mutex
+	onProgress func(Progress)
+
+	copiedEntries int64
+	copiedBytes   int64
+	totalEntries  int64
+	totalBytes    int64
+}
+
+func newProgressTracker(onProgress func(Progress)) *progressTracker {
+	if onProgress == nil {
+		return nil
+	}
+
+	return &progressTracker{
+		onProgress:   onProgress,
+		totalEntries: -1,
+		totalBytes:   -1,
+	}
+}
+
+func (t *progressTracker) setTotals(entries, bytes int64) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.totalEntries = entries
+	t.totalBytes = bytes
+}
+
+// report fills the counters in and sends the progress to the callback.
+// The callback is never called concurrently.
+func (t *progressTracker) report(p Progress, entries, bytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.copiedEntries += entries
+	t.copiedBytes += bytes
+
+	p.CopiedEntries = t.copiedEntries
+	p.CopiedBytes = t.copiedBytes
+	p.TotalEntries = t.totalEntries
+	p.TotalBytes = t.totalBytes
+
+	t.onProgress(p)
+}
+
+func (t *progressTracker) start(src, dest string, info os.FileInfo) {
+	if t == nil {
+		return
+	}
+
+	t.report(Progress{Event: EntryStarted, Src: src, Dest: dest, Info: info}, 0, 0)
+}
+
+func (t *progressTracker) finish(src, dest string, info os.FileInfo, err error) {
+	if t == nil {
+		return
+	}
+
+	var entries int64
+
+	if err == nil {
+		entries = 1
+	}
+
+	t.report(Progress{Event: EntryFinished, Src: src, Dest: dest, Info: info, Err: err}, entries, 0)
+}
+
+// reader wraps the reader of a file, so that the bytes read from it are reported.
+func (t *progressTracker) reader(src, dest string, info os.FileInfo, r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+
+	return &progressReader{tracker: t, r: r, src: src, dest: dest, info: info}
+}
+
+type progressReader struct {
+	tracker *progressTracker
+	r       io.Reader
+
+	src      string
+	dest     string
+	info     os.FileInfo
+	bytes    int64
+	strategy CopyStrategy
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.bytes += int64(n)
+
+		r.tracker.report(Progress{
+			Event:    BytesCopied,
+			Src:      r.src,
+			Dest:     r.dest,
+			Info:     r.info,
+			Bytes:    r.bytes,
+			Strategy: r.strategy,
+		}, 0, int64(n))
+	}
+
+	return n, err
+}
+
+// skip reports n bytes as copied without reading them, like the holes of a sparse file.
+func (r *progressReader) skip(n int64) {
+	if n <= 0 {
+		return
+	}
+
+	r.bytes += n
+
+	r.tracker.report(Progress{
+		Event:    BytesCopied,
+		Src:      r.src,
+		Dest:     r.dest,
+		Info:     r.info,
+		Bytes:    r.bytes,
+		Strategy: r.strategy,
+	}, 0, n)
+}
+
+// scan counts the entries and the bytes of src, by walking the source with the filters of Options.Include,
+// Options.Exclude and Options.IgnoreFiles. No callback is called, and the destination is not touched.
+func scan(src string, info os.FileInfo, opt Options) (entries, bytes int64, err error) {
+	if err := checkContext(opt.ctx, src, opt.intent.dest); err != nil {
+		return 0, 0, err
+	}
+
+	if !info.IsDir() {
+		if info.Mode().IsRegular() {
+			return 1, info.Size(), nil
+		}
+
+		return 1, 0, nil
+	}
+
+	// The errors are left to the copy.
+	contents, err := afero.ReadDir(opt.SrcFs, src)
+	if err != nil {
+		return 1, 0, nil //nolint: nilerr
+	}
+
+	ignores, err := loadIgnoreFiles(src, opt.intent.dest, contents, opt)
+	if err != nil {
+		return 1, 0, nil //nolint: nilerr
+	}
+
+	entries = 1
+
+	for _, content := range contents {
+		child := opt
+		child.rel = filepath.Join(opt.rel, content.Name())
+		child.ignores = ignores
+
+		// The patterns are checked before the copy starts.
+		if out, _ := filtered(child.rel, content, opt); out || ignored(child.rel, content, ignores) { //nolint: errcheck
+			continue
+		}
+
+		e, b, err := scan(filepath.Join(src, content.Name()), content, child)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		entries += e
+		bytes += b
+	}
+
+	return entries, bytes, nil
+}
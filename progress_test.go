@@ -0,0 +1,192 @@
+package aferocopy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// progressFixture is a source of 1300 bytes, and a file to skip.
+var progressFixture = map[string]string{
+	"/src/a.txt":        strings.Repeat("a", 1000),
+	"/src/dir/b.txt":    strings.Repeat("b", 300),
+	"/src/dir/skip.txt": "skip",
+}
+
+func TestOptions_OnProgress(t *testing.T) {
+	t.Parallel()
+
+	var reports []Progress
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:          newFixtureFs(t, progressFixture),
+		CopyBufferSize: 256,
+		Skip: func(_ afero.Fs, src string) (bool, error) {
+			return strings.HasSuffix(src, "skip.txt"), nil
+		},
+		OnProgress: func(p Progress) {
+			reports = append(reports, p)
+		},
+	})
+	require.NoError(t, err)
+
+	var started, finished, chunks int
+
+	for _, p := range reports {
+		switch p.Event {
+		case EntryStarted:
+			started++
+
+		case EntryFinished:
+			finished++
+
+			require.NoError(t, p.Err)
+
+		case BytesCopied:
+			chunks++
+		}
+
+		assert.Equal(t, int64(-1), p.TotalEntries)
+		assert.Equal(t, int64(-1), p.TotalBytes)
+	}
+
+	// /src, /src/a.txt, /src/dir, /src/dir/b.txt
+	assert.Equal(t, 4, started)
+	assert.Equal(t, 4, finished)
+	assert.Greater(t, chunks, 2)
+
+	last := reports[len(reports)-1]
+
+	assert.Equal(t, EntryFinished, last.Event)
+	assert.Equal(t, "/src", last.Src)
+	assert.Equal(t, "/dest", last.Dest)
+	assert.Equal(t, int64(4), last.CopiedEntries)
+	assert.Equal(t, int64(1300), last.CopiedBytes)
+}
+
+func TestOptions_OnProgress_BytesCopied(t *testing.T) {
+	t.Parallel()
+
+	var sizes []int64
+
+	err := Copy("/src/a.txt", "/dest/a.txt", Options{
+		SrcFs:          newFixtureFs(t, progressFixture),
+		CopyBufferSize: 256,
+		OnProgress: func(p Progress) {
+			if p.Event == BytesCopied {
+				sizes = append(sizes, p.Bytes)
+			}
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []int64{256, 512, 768, 1000}, sizes)
+}
+
+func TestOptions_PreScan(t *testing.T) {
+	t.Parallel()
+
+	var reports []Progress
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:   newFixtureFs(t, progressFixture),
+		Exclude: []string{"**/skip.txt"},
+		PreScan: true,
+		OnProgress: func(p Progress) {
+			reports = append(reports, p)
+		},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, reports)
+
+	for _, p := range reports {
+		assert.Equal(t, int64(4), p.TotalEntries)
+		assert.Equal(t, int64(1300), p.TotalBytes)
+	}
+
+	last := reports[len(reports)-1]
+
+	assert.Equal(t, last.TotalEntries, last.CopiedEntries)
+	assert.Equal(t, last.TotalBytes, last.CopiedBytes)
+}
+
+func TestOptions_OnProgress_Error(t *testing.T) {
+	t.Parallel()
+
+	var finished []Progress
+
+	fs := newFixtureFs(t, progressFixture)
+	destFs := afero.NewMemMapFs()
+
+	// A file where a directory should be created.
+	require.NoError(t, afero.WriteFile(destFs, "/dest/dir", nil, 0o644))
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:  fs,
+		DestFs: afero.NewReadOnlyFs(destFs),
+		OnProgress: func(p Progress) {
+			if p.Event == EntryFinished {
+				finished = append(finished, p)
+			}
+		},
+	})
+	require.Error(t, err)
+	require.NotEmpty(t, finished)
+
+	last := finished[len(finished)-1]
+
+	assert.Equal(t, "/src", last.Src)
+	assert.Equal(t, err, last.Err) //nolint: testifylint
+}
+
+func TestOptions_PreScan_CallbacksOnce(t *testing.T) {
+	t.Parallel()
+
+	src, dest := filepath.Join(t.TempDir(), "src"), filepath.Join(t.TempDir(), "dest")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "dir", "b.txt"), []byte("b"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dest, "dir", "b.txt"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "a.txt"), []byte("old a"), 0o644))
+
+	var onError, onFileExists, onDirExists, skip int
+
+	_, err := CopyWithResult(context.Background(), src, dest, Options{
+		PreScan:    true,
+		OnProgress: func(Progress) {},
+		OnError: func(*CopyError) ErrorAction {
+			onError++
+
+			return Continue
+		},
+		OnFileExists: func(afero.Fs, string, os.FileInfo, afero.Fs, string, os.FileInfo) FileExistsAction {
+			onFileExists++
+
+			return Overwrite
+		},
+		OnDirExists: func(afero.Fs, string, afero.Fs, string) DirExistsAction {
+			onDirExists++
+
+			return Merge
+		},
+		Skip: func(afero.Fs, string) (bool, error) {
+			skip++
+
+			return false, nil
+		},
+	})
+	require.Error(t, err)
+
+	// dir/b.txt is a directory in the destination.
+	assert.Equal(t, 1, onError)
+	assert.Equal(t, 1, onFileExists)
+	assert.Equal(t, 1, onDirExists)
+	assert.Equal(t, 3, skip)
+}
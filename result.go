@@ -0,0 +1,189 @@
+package aferocopy
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+)
+
+// SkipReason tells why an entry is not copied.
+type SkipReason int
+
+const (
+	// SkippedByCallback means Options.Skip returned true for the entry.
+	SkippedByCallback SkipReason = iota
+	// SkippedUntouchable means Options.OnDirExists returned Untouchable for the directory.
+	SkippedUntouchable
+	// SkippedSymlink means Options.OnSymlink returned Skip for the symlink.
+	SkippedSymlink
+	// SkippedUpToDate means the file is up to date in the destination, following Options.Update.
+	SkippedUpToDate
+	// SkippedExisting means the file already exists in the destination, and Options.OnFileExists decided to keep it.
+	SkippedExisting
+	// SkippedCheckpoint means the entry is already copied by a previous copy, following Options.Checkpoint.
+	SkippedCheckpoint
+	// SkippedByFilter means the entry is left out by Options.Include or Options.Exclude.
+	SkippedByFilter
+	// SkippedByIgnoreFile means the entry is ignored by one of Options.IgnoreFiles.
+	SkippedByIgnoreFile
+	// SkippedSpecialFile means the special file is not copied, because the destination cannot create it or because it
+	// is a socket, and Options.OnSpecialFile decided to skip it.
+	SkippedSpecialFile
+)
+
+var skipReasons = map[SkipReason]string{
+	SkippedByCallback:   "skipped by callback",
+	SkippedUntouchable:  "untouchable",
+	SkippedSymlink:      "symlink skipped",
+	SkippedUpToDate:     "up to date",
+	SkippedExisting:     "already exists",
+	SkippedCheckpoint:   "already copied",
+	SkippedByFilter:     "filtered",
+	SkippedByIgnoreFile: "ignored",
+	SkippedSpecialFile:  "special file",
+}
+
+// String returns a description of the reason.
+func (r SkipReason) String() string {
+	if s, ok := skipReasons[r]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("SkipReason(%d)", int(r))
+}
+
+// SkippedEntry is an entry that is not copied.
+type SkippedEntry struct {
+	Src    string
+	Dest   string
+	Reason SkipReason
+}
+
+// Result is the report of a copy.
+type Result struct {
+	// Files, Dirs, Symlinks, Pipes and Devices are the number of entries copied, by type.
+	Files    int64
+	Dirs     int64
+	Symlinks int64
+	Pipes    int64
+	Devices  int64
+
+	// HardLinks is the number of files linked to another file copied, with Options.PreserveHardLinks.
+	HardLinks int64
+
+	// Bytes is the number of bytes copied.
+	Bytes int64
+
+	// Strategies are the number of files copied with each strategy, see Options.FastCopy.
+	Strategies map[CopyStrategy]int64
+
+	// Skipped are the entries that are not copied, in the order they are skipped.
+	Skipped []SkippedEntry
+
+	// Removed are the entries removed from the destination because they do not exist in the source, with Mirror.
+	Removed []string
+
+	// Backups are the existing destination files backed up before being overwritten, with Options.Backup.
+	Backups []BackupEntry
+
+	// Elapsed is how long the copy took.
+	Elapsed time.Duration
+}
+
+// CopyWithResult copies src to dest like CopyContext, and returns the report of the copy.
+// The result is returned even if the copy fails, with what is done before the failure.
+func CopyWithResult(ctx context.Context, src, dest string, opt ...Options) (*Result, error) {
+	start := time.Now()
+	result := &resultCollector{}
+
+	err := copyContext(ctx, src, dest, result, opt...)
+
+	r := result.result()
+	r.Elapsed = time.Since(start)
+
+	return r, err
+}
+
+// resultCollector collects the result of a copy, it is safe for concurrent use.
+// A nil collector collects nothing.
+type resultCollector struct {
+	mu sync.Mutex
+	r  Result
+}
+
+func (c *resultCollector) result() *Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := c.r
+	r.Skipped = append([]SkippedEntry(nil), c.r.Skipped...)
+	r.Removed = append([]string(nil), c.r.Removed...)
+	r.Backups = append([]BackupEntry(nil), c.r.Backups...)
+	r.Strategies = maps.Clone(c.r.Strategies)
+
+	return &r
+}
+
+func (c *resultCollector) update(f func(r *Result)) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f(&c.r)
+}
+
+func (c *resultCollector) addFile(bytes int64, strategy CopyStrategy) {
+	c.update(func(r *Result) {
+		r.Files++
+		r.Bytes += bytes
+
+		if r.Strategies == nil {
+			r.Strategies = make(map[CopyStrategy]int64)
+		}
+
+		r.Strategies[strategy]++
+	})
+}
+
+func (c *resultCollector) addDir() {
+	c.update(func(r *Result) { r.Dirs++ })
+}
+
+func (c *resultCollector) addSymlink() {
+	c.update(func(r *Result) { r.Symlinks++ })
+}
+
+func (c *resultCollector) addPipe() {
+	c.update(func(r *Result) { r.Pipes++ })
+}
+
+func (c *resultCollector) addDevice() {
+	c.update(func(r *Result) { r.Devices++ })
+}
+
+func (c *resultCollector) addHardLink() {
+	c.update(func(r *Result) { r.HardLinks++ })
+}
+
+func (c *resultCollector) skip(src, dest string, reason SkipReason) {
+	c.update(func(r *Result) {
+		r.Skipped = append(r.Skipped, SkippedEntry{Src: src, Dest: dest, Reason: reason})
+	})
+}
+
+func (c *resultCollector) remove(dest string) {
+	c.update(func(r *Result) {
+		r.Removed = append(r.Removed, dest)
+	})
+}
+
+func (c *resultCollector) backup(dest, backup string) {
+	c.update(func(r *Result) {
+		r.Backups = append(r.Backups, BackupEntry{Dest: dest, Backup: backup})
+	})
+}
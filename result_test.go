@@ -0,0 +1,106 @@
+package aferocopy
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyWithResult(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("hello"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/dir/b.txt", []byte("world!"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/dir/b.skip", []byte("skip"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/keep/c.txt", []byte("c"), 0o644))
+	require.NoError(t, fs.MkdirAll("/dest/keep", 0o755))
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:       fs,
+		Concurrency: 2,
+		Skip: func(_ afero.Fs, src string) (bool, error) {
+			return strings.HasSuffix(src, ".skip"), nil
+		},
+		OnDirExists: func(afero.Fs, string, afero.Fs, string) DirExistsAction {
+			return Untouchable
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(2), result.Files)
+	assert.Equal(t, int64(2), result.Dirs)
+	assert.Equal(t, int64(0), result.Symlinks)
+	assert.Equal(t, int64(0), result.Pipes)
+	assert.Equal(t, int64(11), result.Bytes)
+	assert.Positive(t, result.Elapsed)
+	assert.ElementsMatch(t, []SkippedEntry{
+		{Src: "/src/dir/b.skip", Dest: "/dest/dir/b.skip", Reason: SkippedByCallback},
+		{Src: "/src/keep", Dest: "/dest/keep", Reason: SkippedUntouchable},
+	}, result.Skipped)
+}
+
+func TestCopyWithResult_Error(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("hello"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/b.txt", []byte("world"), 0o644))
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:  &failingOpenFs{Fs: fs, errs: map[string]error{"/src/b.txt": errors.New("could not open")}},
+		DestFs: afero.NewMemMapFs(),
+	})
+	require.EqualError(t, err, "open /src/b.txt -> /dest/b.txt (source): could not open")
+	require.NotNil(t, result)
+
+	assert.Equal(t, int64(1), result.Files)
+	assert.Equal(t, int64(0), result.Dirs)
+	assert.Equal(t, int64(5), result.Bytes)
+}
+
+func TestCopyWithResult_Symlink(t *testing.T) {
+	result, err := CopyWithResult(context.Background(), "resources/fixtures/data/case03", "resources/test/data.copy/case03.result")
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), result.Symlinks)
+
+	result, err = CopyWithResult(context.Background(), "resources/fixtures/data/case03", "resources/test/data.copy/case03.result.skip", Options{
+		OnSymlink: func(afero.Fs, string) SymlinkAction { return Skip },
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(0), result.Symlinks)
+	assert.Equal(t, []SkippedEntry{{
+		Src:    "resources/fixtures/data/case03/case01",
+		Dest:   "resources/test/data.copy/case03.result.skip/case01",
+		Reason: SkippedSymlink,
+	}}, result.Skipped)
+}
+
+func TestCopyWithResult_NamedPipe(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "js" {
+		t.Skip("See https://github.com/otiai10/copy/issues/47")
+	}
+
+	result, err := CopyWithResult(context.Background(), "resources/fixtures/data/case11", "resources/test/data.copy/case11.result")
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), result.Pipes)
+	assert.Equal(t, int64(2), result.Dirs)
+}
+
+func TestSkipReason_String(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "untouchable", SkippedUntouchable.String())
+	assert.Equal(t, "SkipReason(42)", SkipReason(42).String())
+}
@@ -0,0 +1,207 @@
+package aferocopy
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// skipEntryFixture is a source with files and directories at several depths.
+var skipEntryFixture = map[string]string{
+	"/src/a.txt":        "x",
+	"/src/b/1.txt":      "x",
+	"/src/b/2.txt":      "x",
+	"/src/b/3.txt":      "x",
+	"/src/c/deep/d.txt": "x",
+	"/src/e.txt":        "x",
+}
+
+func TestOptions_SkipEntry(t *testing.T) {
+	t.Parallel()
+
+	srcFs := newFixtureFs(t, skipEntryFixture)
+	destFs := afero.NewMemMapFs()
+
+	type call struct {
+		src   string
+		dest  string
+		dir   bool
+		depth int
+	}
+
+	var calls []call
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:  srcFs,
+		DestFs: destFs,
+		SkipEntry: func(_ afero.Fs, src string, info os.FileInfo, dest string, depth int) (bool, error) {
+			calls = append(calls, call{src: src, dest: dest, dir: info.IsDir(), depth: depth})
+
+			return src == "/src/e.txt", nil
+		},
+	})
+	require.NoError(t, err)
+
+	expected := []call{
+		{src: "/src/a.txt", dest: "/dest/a.txt", depth: 1},
+		{src: "/src/b", dest: "/dest/b", dir: true, depth: 1},
+		{src: "/src/b/1.txt", dest: "/dest/b/1.txt", depth: 2},
+		{src: "/src/b/2.txt", dest: "/dest/b/2.txt", depth: 2},
+		{src: "/src/b/3.txt", dest: "/dest/b/3.txt", depth: 2},
+		{src: "/src/c", dest: "/dest/c", dir: true, depth: 1},
+		{src: "/src/c/deep", dest: "/dest/c/deep", dir: true, depth: 2},
+		{src: "/src/c/deep/d.txt", dest: "/dest/c/deep/d.txt", depth: 3},
+		{src: "/src/e.txt", dest: "/dest/e.txt", depth: 1},
+	}
+
+	assert.Equal(t, expected, calls)
+	assert.Equal(t, []string{"a.txt", "b", "c"}, dirNames(t, destFs, "/dest"))
+}
+
+func TestOptions_SkipEntry_SkipDir(t *testing.T) {
+	t.Parallel()
+
+	srcFs := newFixtureFs(t, skipEntryFixture)
+	destFs := afero.NewMemMapFs()
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:  srcFs,
+		DestFs: destFs,
+		SkipEntry: func(_ afero.Fs, src string, _ os.FileInfo, _ string, _ int) (bool, error) {
+			switch src {
+			case "/src/c", "/src/b/2.txt":
+				return false, fs.SkipDir
+			}
+
+			return false, nil
+		},
+	})
+	require.NoError(t, err)
+
+	// The directory is skipped, and so are the rest of the directory of the file.
+	assert.Equal(t, []string{"a.txt", "b", "e.txt"}, dirNames(t, destFs, "/dest"))
+	assert.Equal(t, []string{"1.txt"}, dirNames(t, destFs, "/dest/b"))
+
+	assert.Equal(t, []SkippedEntry{
+		{Src: "/src/b/2.txt", Dest: "/dest/b/2.txt", Reason: SkippedByCallback},
+		{Src: "/src/c", Dest: "/dest/c", Reason: SkippedByCallback},
+	}, result.Skipped)
+}
+
+func TestOptions_SkipEntry_SkipDir_Symlink(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		target   string
+		expected []string
+	}{
+		{
+			// The directory is skipped, and the rest is copied.
+			scenario: "directory",
+			target:   "real",
+			expected: []string{"b.txt"},
+		},
+		{
+			// The rest of the directory of the link is skipped.
+			scenario: "file",
+			target:   "real.txt",
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			src, dest := filepath.Join(dir, "src"), filepath.Join(dir, "dest")
+			target := filepath.Join(dir, tc.target)
+
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "real"), 0o755))
+			require.NoError(t, os.MkdirAll(src, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "real", "c.txt"), []byte("c"), 0o644))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "real.txt"), []byte("real"), 0o644))
+			require.NoError(t, os.WriteFile(filepath.Join(src, "b.txt"), []byte("b"), 0o644))
+			require.NoError(t, os.Symlink(target, filepath.Join(src, "a_link")))
+
+			result, err := CopyWithResult(context.Background(), src, dest, Options{
+				OnSymlink: func(afero.Fs, string) SymlinkAction {
+					return Deep
+				},
+				SkipEntry: func(_ afero.Fs, src string, _ os.FileInfo, _ string, _ int) (bool, error) {
+					if src == target {
+						return false, fs.SkipDir
+					}
+
+					return false, nil
+				},
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, dirNames(t, afero.NewOsFs(), dest))
+			assert.Equal(t, []SkippedEntry{
+				{Src: target, Dest: filepath.Join(dest, "a_link"), Reason: SkippedByCallback},
+			}, result.Skipped)
+		})
+	}
+}
+
+func TestOptions_SkipEntry_SkipAll(t *testing.T) {
+	t.Parallel()
+
+	srcFs := newFixtureFs(t, skipEntryFixture)
+	destFs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(destFs, "/dest/z.txt", []byte("z"), 0o644))
+
+	var calls int
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:   srcFs,
+		DestFs:  destFs,
+		PreScan: true,
+		OnProgress: func(Progress) {
+		},
+		MirrorDest: true,
+		OnDirExists: func(afero.Fs, string, afero.Fs, string) DirExistsAction {
+			return Mirror
+		},
+		SkipEntry: func(_ afero.Fs, src string, _ os.FileInfo, _ string, _ int) (bool, error) {
+			calls++
+
+			if src == "/src/b/2.txt" {
+				return false, fs.SkipAll
+			}
+
+			return false, nil
+		},
+	})
+	require.NoError(t, err)
+
+	// The copy stops without any error, and nothing is mirrored. The pre-scan does not call SkipEntry.
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, []string{"a.txt", "b", "z.txt"}, dirNames(t, destFs, "/dest"))
+	assert.Equal(t, []string{"1.txt"}, dirNames(t, destFs, "/dest/b"))
+}
+
+func TestOptions_SkipEntry_Error(t *testing.T) {
+	t.Parallel()
+
+	srcFs := newFixtureFs(t, skipEntryFixture)
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:  srcFs,
+		DestFs: afero.NewMemMapFs(),
+		SkipEntry: func(afero.Fs, string, os.FileInfo, string, int) (bool, error) {
+			return false, assert.AnError
+		},
+	})
+	require.ErrorIs(t, err, assert.AnError)
+}
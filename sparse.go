@@ -0,0 +1,151 @@
+package aferocopy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// sparseBlockSize is the size of the blocks of zeros that are skipped, when the holes are not known.
+const sparseBlockSize = 4096
+
+var zeroBlock [sparseBlockSize]byte
+
+// copySparse copies the content of the source, opened as s and read through r, to f from offset, without writing
+// the holes, then truncates f to where the content ends. It returns the number of bytes copied, holes included.
+func copySparse(src, dest string, info os.FileInfo, s afero.File, r io.Reader, sr *sourceReader, f afero.File, offset int64, opt Options) (int64, error) {
+	end, ok, err := copyDataSegments(src, dest, info, s, r, sr, f, offset, opt)
+	if !ok {
+		end, err = copyNonZeroBlocks(src, dest, r, sr, f, offset, opt)
+	}
+
+	if err != nil {
+		return end - offset, err
+	}
+
+	if err := f.Truncate(end); err != nil {
+		return end - offset, destError("truncate", src, dest, err)
+	}
+
+	return end - offset, nil
+}
+
+// copyDataSegments copies the segments of data that the source tells, and seeks over its holes.
+// It copies nothing and returns false if the source does not tell them.
+func copyDataSegments(src, dest string, info os.FileInfo, s afero.File, r io.Reader, sr *sourceReader, f afero.File, offset int64, opt Options) (int64, bool, error) {
+	var buf []byte
+
+	if opt.CopyBufferSize != 0 {
+		buf = make([]byte, opt.CopyBufferSize)
+	}
+
+	// Disable using `ReadFrom` by io.CopyBuffer, the segments are copied as they are read.
+	w := struct{ io.Writer }{f}
+	pos, size := offset, info.Size()
+
+	for pos < size {
+		data, hole, err := seekData(s, pos, size)
+
+		switch {
+		case errors.Is(err, errors.ErrUnsupported) && pos == offset:
+			return pos, false, nil
+
+		case err != nil:
+			return pos, true, srcError("seek", src, dest, err)
+		}
+
+		skipProgress(r, data-pos)
+
+		if data >= size {
+			return size, true, nil
+		}
+
+		if _, err := f.Seek(data, io.SeekStart); err != nil {
+			return data, true, destError("seek", src, dest, err)
+		}
+
+		n, err := io.CopyBuffer(w, io.LimitReader(r, hole-data), buf)
+		if err != nil {
+			return data + n, true, contentError(src, dest, sr, err)
+		}
+
+		pos = data + n
+
+		// The source is shorter than it was.
+		if pos < hole {
+			return pos, true, nil
+		}
+	}
+
+	return pos, true, nil
+}
+
+// copyNonZeroBlocks copies the content of the source, and seeks over its blocks of zeros.
+func copyNonZeroBlocks(src, dest string, r io.Reader, sr *sourceReader, f afero.File, offset int64, opt Options) (int64, error) {
+	size := 32 * 1024
+
+	if opt.CopyBufferSize != 0 {
+		size = int(opt.CopyBufferSize)
+	}
+
+	buf := make([]byte, max(size, sparseBlockSize))
+	pos := offset
+
+	for {
+		n, rerr := io.ReadFull(r, buf)
+
+		if err := writeNonZero(f, buf[:n]); err != nil {
+			return pos, destError("write", src, dest, err)
+		}
+
+		pos += int64(n)
+
+		switch {
+		case errors.Is(rerr, io.EOF), errors.Is(rerr, io.ErrUnexpectedEOF):
+			return pos, nil
+
+		case rerr != nil:
+			return pos, contentError(src, dest, sr, rerr)
+		}
+	}
+}
+
+// writeNonZero writes p to w, but seeks over its blocks of zeros.
+func writeNonZero(w afero.File, p []byte) error {
+	for len(p) > 0 {
+		n := min(len(p), sparseBlockSize)
+		zero := bytes.Equal(p[:n], zeroBlock[:n])
+
+		// Group the blocks of the same kind.
+		for n < len(p) {
+			next := min(len(p)-n, sparseBlockSize)
+			if bytes.Equal(p[n:n+next], zeroBlock[:next]) != zero {
+				break
+			}
+
+			n += next
+		}
+
+		if zero {
+			if _, err := w.Seek(int64(n), io.SeekCurrent); err != nil {
+				return err
+			}
+		} else if _, err := w.Write(p[:n]); err != nil {
+			return err
+		}
+
+		p = p[n:]
+	}
+
+	return nil
+}
+
+// skipProgress reports the bytes of a hole as copied.
+func skipProgress(r io.Reader, n int64) {
+	if r, ok := r.(*progressReader); ok {
+		r.skip(n)
+	}
+}
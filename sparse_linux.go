@@ -0,0 +1,50 @@
+//go:build linux
+// +build linux
+
+package aferocopy
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	seekDataWhence = 3 // SEEK_DATA
+	seekHoleWhence = 4 // SEEK_HOLE
+)
+
+// seekData returns where the next segment of data of the file starts from offset, and where it ends, then seeks to
+// its start. The data starts at size when there is none left.
+func seekData(f afero.File, offset, size int64) (data, hole int64, err error) {
+	file, ok := f.(*os.File)
+	if !ok {
+		return 0, 0, errors.ErrUnsupported
+	}
+
+	data, err = file.Seek(offset, seekDataWhence)
+
+	switch {
+	case errors.Is(err, syscall.ENXIO):
+		return size, size, nil
+
+	case errors.Is(err, syscall.EINVAL):
+		return 0, 0, errors.ErrUnsupported
+
+	case err != nil:
+		return 0, 0, err
+	}
+
+	if hole, err = file.Seek(data, seekHoleWhence); err != nil {
+		return 0, 0, err
+	}
+
+	if _, err := file.Seek(data, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+
+	return data, min(hole, size), nil
+}
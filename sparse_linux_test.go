@@ -0,0 +1,59 @@
+//go:build linux
+// +build linux
+
+package aferocopy
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func allocated(t *testing.T, name string) int64 {
+	t.Helper()
+
+	info, err := os.Stat(name)
+	require.NoError(t, err)
+
+	return info.Sys().(*syscall.Stat_t).Blocks * 512 //nolint: forcetypeassert
+}
+
+func TestOptions_Sparse_SeekData(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	src, dest := filepath.Join(dir, "src.img"), filepath.Join(dir, "dest.img")
+
+	const size = 64 << 20
+
+	f, err := os.Create(src)
+	require.NoError(t, err)
+
+	_, err = f.WriteAt([]byte("data"), 16<<20)
+	require.NoError(t, err)
+	require.NoError(t, f.Truncate(size))
+	require.NoError(t, f.Close())
+
+	if allocated(t, src) >= size {
+		t.Skip("the filesystem does not support sparse files")
+	}
+
+	err = Copy(src, dest, Options{Sparse: true})
+	require.NoError(t, err)
+
+	info, err := os.Stat(dest)
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), info.Size())
+	assert.Less(t, allocated(t, dest), int64(1<<20))
+
+	content, err := os.ReadFile(dest)
+	require.NoError(t, err)
+
+	expected, err := os.ReadFile(src)
+	require.NoError(t, err)
+	assert.Equal(t, expected, content)
+}
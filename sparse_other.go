@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package aferocopy
+
+import (
+	"errors"
+
+	"github.com/spf13/afero"
+)
+
+// seekData is only supported on linux, the holes are found as blocks of zeros otherwise.
+func seekData(_ afero.File, _, _ int64) (data, hole int64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
@@ -0,0 +1,106 @@
+package aferocopy
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCountingFs counts the bytes written to the files it creates.
+type writeCountingFs struct {
+	afero.Fs
+
+	written *int64
+}
+
+func (fs writeCountingFs) Create(name string) (afero.File, error) {
+	f, err := fs.Fs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return writeCountingFile{File: f, written: fs.written}, nil
+}
+
+type writeCountingFile struct {
+	afero.File
+
+	written *int64
+}
+
+func (f writeCountingFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	*f.written += int64(n)
+
+	return n, err
+}
+
+func TestOptions_Sparse(t *testing.T) {
+	t.Parallel()
+
+	content := make([]byte, 64*1024)
+	copy(content[10_000:], "data")
+	copy(content[40_000:], "more data")
+
+	testCases := []struct {
+		scenario string
+		content  []byte
+		written  int64
+	}{
+		{
+			scenario: "holes",
+			content:  content,
+			written:  2 * sparseBlockSize,
+		},
+		{
+			scenario: "trailing hole",
+			content:  content[:50_000],
+			written:  2 * sparseBlockSize,
+		},
+		{
+			scenario: "only a hole",
+			content:  make([]byte, 10_000),
+		},
+		{
+			scenario: "empty",
+			content:  []byte{},
+		},
+		{
+			scenario: "no hole",
+			content:  bytes.Repeat([]byte("x"), 10_000),
+			written:  10_000,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			srcFs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(srcFs, "/src/disk.img", tc.content, 0o644))
+
+			var written int64
+
+			destFs := writeCountingFs{Fs: afero.NewMemMapFs(), written: &written}
+
+			res, err := CopyWithResult(context.Background(), "/src/disk.img", "/dest/disk.img", Options{
+				SrcFs:          srcFs,
+				DestFs:         destFs,
+				Sparse:         true,
+				CopyBufferSize: 5000,
+			})
+			require.NoError(t, err)
+
+			actual, err := afero.ReadFile(destFs, "/dest/disk.img")
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.content, actual)
+			assert.Equal(t, tc.written, written)
+			assert.Equal(t, int64(len(tc.content)), res.Bytes)
+		})
+	}
+}
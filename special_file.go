@@ -0,0 +1,131 @@
+package aferocopy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// Mkfifoer is implemented by the filesystems that can create named pipes. afero.OsFs can without it.
+// It returns an error matching errors.ErrUnsupported when it cannot.
+type Mkfifoer interface {
+	MkfifoIfPossible(name string, mode os.FileMode) error
+}
+
+// SpecialFileAction represents what to do with a special file, like a named pipe, that the destination cannot
+// create.
+type SpecialFileAction int
+
+const (
+	// SkipSpecialFile does not copy the special file (default behavior).
+	SkipSpecialFile SpecialFileAction = iota
+	// FailSpecialFile fails the copy of the special file.
+	FailSpecialFile
+	// CreateEmptyFile creates an empty regular file instead, with the permission of the special file.
+	CreateEmptyFile
+)
+
+// mkfifo creates a named pipe with the filesystem, if it can.
+func mkfifo(fs afero.Fs, name string, mode os.FileMode) error {
+	switch fs := fs.(type) {
+	case Mkfifoer:
+		return fs.MkfifoIfPossible(name, mode)
+
+	case *afero.OsFs:
+		return hostMkfifo(name, mode)
+	}
+
+	return &os.PathError{Op: "mkfifo", Path: name, Err: errors.ErrUnsupported}
+}
+
+// canMkfifo tells whether the filesystem may create named pipes.
+func canMkfifo(fs afero.Fs) bool {
+	switch fs.(type) {
+	case Mkfifoer, *afero.OsFs:
+		return true
+	}
+
+	return false
+}
+
+// copyPipe is for just named pipes.
+func copyPipe(src, dest string, info os.FileInfo, opt Options) error {
+	destFs := opt.DestFs
+
+	if !canMkfifo(destFs) {
+		return onSpecialFile("mkfifo", src, dest, info, opt)
+	}
+
+	if err := destFs.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return destError("mkdir", src, dest, err)
+	}
+
+	err := mkfifo(destFs, dest, info.Mode())
+	if errors.Is(err, errors.ErrUnsupported) {
+		return onSpecialFile("mkfifo", src, dest, info, opt)
+	}
+
+	if err != nil {
+		return destError("mkfifo", src, dest, err)
+	}
+
+	opt.result.addPipe()
+
+	return nil
+}
+
+// onSpecialFile handles the special file that the destination cannot create with op, following
+// Options.OnSpecialFile.
+func onSpecialFile(op, src, dest string, info os.FileInfo, opt Options) error {
+	action := SkipSpecialFile
+
+	if opt.OnSpecialFile != nil {
+		action = opt.OnSpecialFile(opt.SrcFs, src, info)
+	}
+
+	switch action {
+	case FailSpecialFile:
+		return destError(op, src, dest, errors.ErrUnsupported)
+
+	case CreateEmptyFile:
+		return createEmptyFile(src, dest, info, opt)
+
+	case SkipSpecialFile:
+		fallthrough
+
+	default:
+		opt.result.skip(src, dest, SkippedSpecialFile)
+
+		return nil
+	}
+}
+
+// createEmptyFile creates an empty regular file at dest, instead of the special file src.
+func createEmptyFile(src, dest string, info os.FileInfo, opt Options) (err error) {
+	destFs := opt.DestFs
+
+	if err := destFs.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return destError("mkdir", src, dest, err)
+	}
+
+	f, err := destFs.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return destError("create", src, dest, err)
+	}
+
+	defer closeFile(f, &err, func(err error) error {
+		return destError("close", src, dest, err)
+	})
+
+	if opt.PreserveTimes {
+		if err := preserveTimes(info, destFs, dest); err != nil {
+			return destError("chtimes", src, dest, err)
+		}
+	}
+
+	opt.result.addFile(0, BufferedCopy)
+
+	return nil
+}
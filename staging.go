@@ -0,0 +1,171 @@
+package aferocopy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// copyDirStaged replaces destDir by copying srcDir into a staging directory next to it first, then swapping them.
+// The existing directory is left as it is if the copy fails.
+func copyDirStaged(srcDir, destDir string, info os.FileInfo, opt Options) error {
+	destFs := opt.DestFs
+	staging := siblingName(destDir, "stage")
+
+	staged := opt
+	staged.DestFs = newStagingFs(destFs, destDir, staging)
+
+	if err := copyDir(srcDir, destDir, info, staged); err != nil {
+		ignore(destFs.RemoveAll(staging))
+
+		return err
+	}
+
+	old := siblingName(destDir, "old")
+
+	if err := destFs.Rename(destDir, old); err != nil {
+		ignore(destFs.RemoveAll(staging))
+
+		return destError("rename", srcDir, destDir, err)
+	}
+
+	if err := destFs.Rename(staging, destDir); err != nil {
+		ignore(destFs.Rename(old, destDir))
+		ignore(destFs.RemoveAll(staging))
+
+		return destError("rename", srcDir, destDir, err)
+	}
+
+	return destError("removeall", srcDir, destDir, destFs.RemoveAll(old))
+}
+
+// stagingFs redirects the paths under dir to the staging directory.
+type stagingFs struct {
+	base    afero.Fs
+	dir     string
+	staging string
+}
+
+var (
+	_ afero.Fs        = (*stagingFs)(nil)
+	_ afero.Lstater   = (*stagingFs)(nil)
+	_ afero.Symlinker = (*stagingSymlinkFs)(nil)
+	_ Mkfifoer        = (*stagingFs)(nil)
+	_ Mknoder         = (*stagingFs)(nil)
+	_ HardLinker      = (*stagingFs)(nil)
+)
+
+func newStagingFs(base afero.Fs, dir, staging string) afero.Fs {
+	fs := &stagingFs{base: base, dir: filepath.Clean(dir), staging: staging}
+
+	if _, ok := base.(afero.Symlinker); ok {
+		return &stagingSymlinkFs{stagingFs: fs}
+	}
+
+	return fs
+}
+
+func (fs *stagingFs) path(name string) string {
+	name = filepath.Clean(name)
+
+	if name == fs.dir {
+		return fs.staging
+	}
+
+	if rel, ok := strings.CutPrefix(name, fs.dir+string(filepath.Separator)); ok {
+		return filepath.Join(fs.staging, rel)
+	}
+
+	return name
+}
+
+func (fs *stagingFs) Create(name string) (afero.File, error) {
+	return fs.base.Create(fs.path(name))
+}
+
+func (fs *stagingFs) Mkdir(name string, perm os.FileMode) error {
+	return fs.base.Mkdir(fs.path(name), perm)
+}
+
+func (fs *stagingFs) MkdirAll(path string, perm os.FileMode) error {
+	return fs.base.MkdirAll(fs.path(path), perm)
+}
+
+func (fs *stagingFs) Open(name string) (afero.File, error) {
+	return fs.base.Open(fs.path(name))
+}
+
+func (fs *stagingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	return fs.base.OpenFile(fs.path(name), flag, perm)
+}
+
+func (fs *stagingFs) Remove(name string) error {
+	return fs.base.Remove(fs.path(name))
+}
+
+func (fs *stagingFs) RemoveAll(path string) error {
+	return fs.base.RemoveAll(fs.path(path))
+}
+
+func (fs *stagingFs) Rename(oldname, newname string) error {
+	return fs.base.Rename(fs.path(oldname), fs.path(newname))
+}
+
+func (fs *stagingFs) Stat(name string) (os.FileInfo, error) {
+	return fs.base.Stat(fs.path(name))
+}
+
+func (fs *stagingFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lfs, ok := fs.base.(afero.Lstater); ok {
+		return lfs.LstatIfPossible(fs.path(name))
+	}
+
+	info, err := fs.base.Stat(fs.path(name))
+
+	return info, false, err
+}
+
+func (fs *stagingFs) Name() string {
+	return "StagingFs"
+}
+
+func (fs *stagingFs) Chmod(name string, mode os.FileMode) error {
+	return fs.base.Chmod(fs.path(name), mode)
+}
+
+func (fs *stagingFs) Chown(name string, uid, gid int) error {
+	return fs.base.Chown(fs.path(name), uid, gid)
+}
+
+func (fs *stagingFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return fs.base.Chtimes(fs.path(name), atime, mtime)
+}
+
+func (fs *stagingFs) MkfifoIfPossible(name string, mode os.FileMode) error {
+	return mkfifo(fs.base, fs.path(name), mode)
+}
+
+func (fs *stagingFs) MknodIfPossible(name string, mode os.FileMode, dev uint64) error {
+	return mknod(fs.base, fs.path(name), mode, dev)
+}
+
+func (fs *stagingFs) LinkIfPossible(oldname, newname string) error {
+	return link(fs.base, fs.path(oldname), fs.path(newname))
+}
+
+// stagingSymlinkFs is a stagingFs over a filesystem that supports symlinks.
+type stagingSymlinkFs struct {
+	*stagingFs
+}
+
+func (fs *stagingSymlinkFs) SymlinkIfPossible(oldname, newname string) error {
+	return fs.base.(afero.Symlinker).SymlinkIfPossible(oldname, fs.path(newname)) //nolint: forcetypeassert
+}
+
+// ReadlinkIfPossible reads the link as it is, because it is only called for the source.
+func (fs *stagingSymlinkFs) ReadlinkIfPossible(name string) (string, error) {
+	return fs.base.(afero.Symlinker).ReadlinkIfPossible(name) //nolint: errcheck,forcetypeassert
+}
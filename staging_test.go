@@ -0,0 +1,84 @@
+package aferocopy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stagingFixture is a source, and a destination directory that is replaced by the one of the source.
+var stagingFixture = map[string]string{
+	"/src/dir/a.txt":      "new a",
+	"/src/dir/sub/b.txt":  "new b",
+	"/src/z.txt":          "z",
+	"/dest/dir/a.txt":     "old a",
+	"/dest/dir/extra.txt": "extra",
+}
+
+func replaceAll(afero.Fs, string, afero.Fs, string) DirExistsAction {
+	return Replace
+}
+
+func TestOptions_StagedReplace(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, stagingFixture)
+
+	err := Copy("/src", "/dest", Options{SrcFs: fs, StagedReplace: true, OnDirExists: replaceAll})
+	require.NoError(t, err)
+
+	// Nothing is left next to the directory.
+	assert.Equal(t, []string{"dir", "z.txt"}, dirNames(t, fs, "/dest"))
+	assert.Equal(t, []string{"a.txt", "sub"}, dirNames(t, fs, "/dest/dir"))
+
+	content, err := afero.ReadFile(fs, "/dest/dir/sub/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "new b", string(content))
+}
+
+func TestOptions_StagedReplace_Failure(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, stagingFixture)
+	before := snapshot(t, fs, "/dest")
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:         &failingOpenFs{Fs: fs, errs: map[string]error{"/src/dir/sub/b.txt": errors.New("could not open")}},
+		DestFs:        fs,
+		StagedReplace: true,
+		OnDirExists:   replaceAll,
+	})
+	require.Error(t, err)
+
+	// The error is about the destination, not the staging directory.
+	var copyErr *CopyError
+
+	require.ErrorAs(t, err, &copyErr)
+	assert.Equal(t, "/dest/dir/sub/b.txt", copyErr.Dest)
+
+	assert.Equal(t, before, snapshot(t, fs, "/dest"))
+}
+
+func TestOptions_StagedReplace_Transactional(t *testing.T) {
+	t.Parallel()
+
+	fs := newFixtureFs(t, stagingFixture)
+	require.NoError(t, fs.Chmod("/src/dir/sub/b.txt", 0o600))
+
+	before := snapshot(t, fs, "/")
+
+	// The directory is swapped before the copy fails, then everything is rolled back.
+	err := Copy("/src", "/dest", Options{
+		SrcFs:         &failingOpenFs{Fs: fs, errs: map[string]error{"/src/z.txt": errors.New("could not open")}},
+		DestFs:        fs,
+		StagedReplace: true,
+		Transactional: true,
+		OnDirExists:   replaceAll,
+	})
+	require.ErrorContains(t, err, "could not open")
+
+	assert.Equal(t, before, snapshot(t, fs, "/"))
+}
@@ -0,0 +1,692 @@
+package aferocopy
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// changeType is the type of a change journaled by txFs.
+type changeType int
+
+const (
+	// changeCreated is an entry created by the transaction.
+	changeCreated changeType = iota
+	// changeMovedAside is an existing entry moved aside, because it is replaced or removed.
+	changeMovedAside
+	// changeRenamed is an entry renamed by the transaction.
+	changeRenamed
+	// changeChmod, changeChown and changeChtimes are changes of an existing entry.
+	changeChmod
+	changeChown
+	changeChtimes
+)
+
+// change is a change journaled by txFs, with what is needed to undo it.
+type change struct {
+	typ   changeType
+	path  string
+	other string // The aside path, for changeMovedAside, or the old path, for changeRenamed.
+	mode  os.FileMode
+	uid   int
+	gid   int
+	atime time.Time
+	mtime time.Time
+}
+
+// txFs journals every change to the base filesystem, so that they can be rolled back.
+// The entries that are replaced or removed are moved aside, into a directory next to the destination, until the
+// transaction ends.
+type txFs struct {
+	base  afero.Fs
+	aside string
+
+	mu          sync.Mutex
+	journal     []change
+	created     map[string]struct{}
+	touched     map[string]struct{}
+	asideCount  int
+	asideExists bool
+	asideParent *change
+}
+
+var (
+	_ afero.Fs        = (*txFs)(nil)
+	_ afero.Lstater   = (*txFs)(nil)
+	_ afero.Symlinker = (*txSymlinkFs)(nil)
+	_ Mkfifoer        = (*txFs)(nil)
+	_ Mknoder         = (*txFs)(nil)
+)
+
+func newTxFs(base afero.Fs, dest string) *txFs {
+	return &txFs{
+		base:    base,
+		aside:   siblingName(dest, "txn"),
+		created: make(map[string]struct{}),
+		touched: make(map[string]struct{}),
+	}
+}
+
+// fs returns the filesystem that supports symlinks only if the base one does.
+func (fs *txFs) fs() afero.Fs {
+	if _, ok := fs.base.(afero.Symlinker); ok {
+		return &txSymlinkFs{txFs: fs}
+	}
+
+	return fs
+}
+
+// end commits the transaction if err is nil, or rolls it back otherwise.
+// The errors of the rollback are joined to err.
+func (fs *txFs) end(err error) error {
+	if err == nil {
+		return fs.commit()
+	}
+
+	if rerr := fs.rollback(); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+
+	return err
+}
+
+// commit removes the entries moved aside.
+func (fs *txFs) commit() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if !fs.asideExists {
+		return nil
+	}
+
+	return destError("removeall", "", fs.aside, fs.base.RemoveAll(fs.aside))
+}
+
+// rollback undoes the journaled changes, in reverse order. The entries moved aside are kept if anything fails, so
+// that they can be restored by hand.
+func (fs *txFs) rollback() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var errs []error
+
+	for i := len(fs.journal) - 1; i >= 0; i-- {
+		c := fs.journal[i]
+
+		if err := fs.undo(c); err != nil {
+			errs = append(errs, &CopyError{Op: "rollback", Dest: c.path, Fs: DestSide, Err: err})
+		}
+	}
+
+	fs.journal = nil
+
+	if len(errs) == 0 && fs.asideExists {
+		if err := fs.base.RemoveAll(fs.aside); err != nil {
+			errs = append(errs, &CopyError{Op: "rollback", Dest: fs.aside, Fs: DestSide, Err: err})
+		} else if fs.asideParent != nil {
+			if err := fs.undo(*fs.asideParent); err != nil {
+				errs = append(errs, &CopyError{Op: "rollback", Dest: fs.asideParent.path, Fs: DestSide, Err: err})
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// undo must be called with the lock held.
+func (fs *txFs) undo(c change) error {
+	var err error
+
+	switch c.typ {
+	case changeCreated:
+		err = fs.base.Remove(c.path)
+
+	case changeMovedAside:
+		return fs.base.Rename(c.other, c.path)
+
+	case changeRenamed:
+		err = fs.base.Rename(c.path, c.other)
+
+	case changeChmod:
+		err = fs.base.Chmod(c.path, c.mode)
+
+	case changeChown:
+		err = fs.base.Chown(c.path, c.uid, c.gid)
+
+	case changeChtimes:
+		err = fs.base.Chtimes(c.path, c.atime, c.mtime)
+	}
+
+	// The entry may be removed afterward by the transaction itself.
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// record must be called with the lock held.
+func (fs *txFs) record(c change) {
+	c.path = filepath.Clean(c.path)
+
+	fs.journal = append(fs.journal, c)
+
+	if c.typ == changeCreated {
+		fs.created[c.path] = struct{}{}
+	}
+}
+
+// touch journals the times of the parent of name, before its entries change for the first time.
+// It must be called with the lock held.
+func (fs *txFs) touch(name string) error {
+	parent := filepath.Dir(filepath.Clean(name))
+
+	if _, ok := fs.touched[parent]; ok || fs.isCreated(parent) {
+		return nil
+	}
+
+	if err := fs.journalChange(parent, changeChtimes); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	fs.touched[parent] = struct{}{}
+
+	return nil
+}
+
+// isCreated must be called with the lock held.
+func (fs *txFs) isCreated(name string) bool {
+	_, ok := fs.created[filepath.Clean(name)]
+
+	return ok
+}
+
+// moveAside moves the existing entry out of the way, if any, and tells whether it did.
+// It must be called with the lock held.
+func (fs *txFs) moveAside(name string) (bool, error) {
+	if fs.isCreated(name) {
+		return false, nil
+	}
+
+	if _, err := stat(fs.base, name); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if err := fs.touch(name); err != nil {
+		return false, err
+	}
+
+	if !fs.asideExists {
+		if err := fs.createAside(); err != nil {
+			return false, err
+		}
+	}
+
+	fs.asideCount++
+	aside := filepath.Join(fs.aside, strconv.Itoa(fs.asideCount))
+
+	if err := fs.base.Rename(name, aside); err != nil {
+		return false, err
+	}
+
+	fs.record(change{typ: changeMovedAside, path: name, other: aside})
+
+	return true, nil
+}
+
+// createAside creates the directory where the entries are moved aside, and remembers the times of its parent to
+// restore them once it is removed.
+// It must be called with the lock held.
+func (fs *txFs) createAside() error {
+	parent := filepath.Dir(fs.aside)
+
+	if info, err := stat(fs.base, parent); err == nil {
+		c := timesChange(parent, info)
+		fs.asideParent = &c
+	}
+
+	if err := fs.base.MkdirAll(fs.aside, 0o700); err != nil {
+		return err
+	}
+
+	fs.asideExists = true
+
+	return nil
+}
+
+// restoreAside puts back the last entry moved aside, when the change it is moved aside for fails.
+// It must be called with the lock held.
+func (fs *txFs) restoreAside(moved bool, err error) error {
+	if !moved {
+		return err
+	}
+
+	c := fs.journal[len(fs.journal)-1]
+	fs.journal = fs.journal[:len(fs.journal)-1]
+
+	return errors.Join(err, fs.base.Rename(c.other, c.path))
+}
+
+// saveAside copies the existing file aside, so that it can be written in place.
+// It must be called with the lock held.
+func (fs *txFs) saveAside(name string) (err error) {
+	if _, err := fs.moveAside(name); err != nil {
+		return err
+	}
+
+	c := fs.journal[len(fs.journal)-1]
+
+	defer func() {
+		if err != nil {
+			err = fs.restoreAside(true, err)
+		}
+	}()
+
+	info, err := fs.base.Stat(c.other)
+	if err != nil {
+		return err
+	}
+
+	s, err := fs.base.Open(c.other)
+	if err != nil {
+		return err
+	}
+
+	defer closeFile(s, &err, func(err error) error { return err })
+
+	d, err := fs.base.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	defer closeFile(d, &err, func(err error) error { return err })
+
+	_, err = io.Copy(d, s)
+
+	return err
+}
+
+func (fs *txFs) Create(name string) (afero.File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (fs *txFs) Mkdir(name string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.touch(name); err != nil {
+		return err
+	}
+
+	if err := fs.base.Mkdir(name, perm); err != nil {
+		return err
+	}
+
+	fs.record(change{typ: changeCreated, path: name})
+
+	return nil
+}
+
+func (fs *txFs) MkdirAll(path string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var missing []string
+
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if _, err := stat(fs.base, p); err == nil {
+			break
+		}
+
+		missing = append(missing, p)
+
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+
+	if len(missing) > 0 {
+		if err := fs.touch(missing[len(missing)-1]); err != nil {
+			return err
+		}
+	}
+
+	err := fs.base.MkdirAll(path, perm)
+
+	// Journal what is created, even if it fails half-way.
+	for i := len(missing) - 1; i >= 0; i-- {
+		if _, serr := stat(fs.base, missing[i]); serr != nil {
+			break
+		}
+
+		fs.record(change{typ: changeCreated, path: missing[i]})
+	}
+
+	return err
+}
+
+func (fs *txFs) Open(name string) (afero.File, error) {
+	return fs.base.Open(name)
+}
+
+func (fs *txFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return fs.base.OpenFile(name, flag, perm)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	info, err := stat(fs.base, name)
+
+	switch {
+	case err != nil && !os.IsNotExist(err):
+		return nil, err
+
+	case err != nil:
+		if flag&os.O_CREATE == 0 {
+			return nil, err
+		}
+
+		if err := fs.touch(name); err != nil {
+			return nil, err
+		}
+
+		f, err := fs.base.OpenFile(name, flag, perm)
+		if err == nil {
+			fs.record(change{typ: changeCreated, path: name})
+		}
+
+		return f, err
+
+	case info.IsDir() || fs.isCreated(name) || flag&os.O_EXCL != 0:
+		return fs.base.OpenFile(name, flag, perm)
+
+	case flag&os.O_TRUNC != 0:
+		// The existing file is replaced by a new one.
+		moved, err := fs.moveAside(name)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := fs.base.OpenFile(name, flag|os.O_CREATE, perm)
+		if err != nil {
+			return nil, fs.restoreAside(moved, err)
+		}
+
+		fs.record(change{typ: changeCreated, path: name})
+
+		return f, nil
+
+	default:
+		// The existing file is written in place.
+		if err := fs.saveAside(name); err != nil {
+			return nil, err
+		}
+
+		fs.record(change{typ: changeCreated, path: name})
+
+		return fs.base.OpenFile(name, flag, perm)
+	}
+}
+
+func (fs *txFs) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.isCreated(name) {
+		if err := fs.touch(name); err != nil {
+			return err
+		}
+
+		return fs.base.Remove(name)
+	}
+
+	info, err := stat(fs.base, name)
+	if err != nil {
+		return fs.base.Remove(name)
+	}
+
+	if info.IsDir() {
+		contents, err := afero.ReadDir(fs.base, name)
+		if err != nil {
+			return err
+		}
+
+		if len(contents) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+
+	_, err = fs.moveAside(name)
+
+	return err
+}
+
+func (fs *txFs) RemoveAll(path string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.isCreated(path) {
+		if err := fs.touch(path); err != nil {
+			return err
+		}
+
+		return fs.base.RemoveAll(path)
+	}
+
+	_, err := fs.moveAside(path)
+
+	return err
+}
+
+func (fs *txFs) Rename(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := stat(fs.base, oldname); err != nil {
+		return fs.base.Rename(oldname, newname)
+	}
+
+	if err := errors.Join(fs.touch(oldname), fs.touch(newname)); err != nil {
+		return err
+	}
+
+	moved, err := fs.moveAside(newname)
+	if err != nil {
+		return err
+	}
+
+	if err := fs.base.Rename(oldname, newname); err != nil {
+		return fs.restoreAside(moved, err)
+	}
+
+	fs.record(change{typ: changeRenamed, path: newname, other: oldname})
+
+	if fs.isCreated(oldname) {
+		delete(fs.created, filepath.Clean(oldname))
+		fs.created[filepath.Clean(newname)] = struct{}{}
+	}
+
+	return nil
+}
+
+func (fs *txFs) Stat(name string) (os.FileInfo, error) {
+	return fs.base.Stat(name)
+}
+
+func (fs *txFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lfs, ok := fs.base.(afero.Lstater); ok {
+		return lfs.LstatIfPossible(name)
+	}
+
+	info, err := fs.base.Stat(name)
+
+	return info, false, err
+}
+
+func (fs *txFs) Name() string {
+	return "TxFs"
+}
+
+// journalChange journals the change of an existing entry, unless the entry is created by the transaction.
+// It must be called with the lock held.
+func (fs *txFs) journalChange(name string, typ changeType) error {
+	if fs.isCreated(name) {
+		return nil
+	}
+
+	info, err := stat(fs.base, name)
+	if err != nil {
+		return err
+	}
+
+	switch typ {
+	case changeChown:
+		uid, gid, ok := fileOwner(info)
+		if ok {
+			fs.record(change{typ: changeChown, path: name, uid: uid, gid: gid})
+		}
+
+	case changeChtimes:
+		fs.record(timesChange(name, info))
+
+	case changeCreated, changeMovedAside, changeRenamed, changeChmod:
+		fs.record(change{typ: changeChmod, path: name, mode: info.Mode()})
+	}
+
+	return nil
+}
+
+// timesChange returns the change of the times of an existing entry. The access time is only known from the system,
+// other filesystems, like sftpfs, get the modification time instead.
+func timesChange(name string, info os.FileInfo) change {
+	c := change{typ: changeChtimes, path: name, atime: info.ModTime(), mtime: info.ModTime()}
+
+	if hasFileInfoStat(info.Sys()) {
+		c.atime = getTimeSpec(info).Atime
+	}
+
+	return c
+}
+
+func (fs *txFs) Chmod(name string, mode os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.journalChange(name, changeChmod); err != nil {
+		return err
+	}
+
+	return fs.base.Chmod(name, mode)
+}
+
+func (fs *txFs) Chown(name string, uid, gid int) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.journalChange(name, changeChown); err != nil {
+		return err
+	}
+
+	return fs.base.Chown(name, uid, gid)
+}
+
+func (fs *txFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.journalChange(name, changeChtimes); err != nil {
+		return err
+	}
+
+	return fs.base.Chtimes(name, atime, mtime)
+}
+
+func (fs *txFs) MkfifoIfPossible(name string, mode os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.touch(name); err != nil {
+		return err
+	}
+
+	if err := mkfifo(fs.base, name, mode); err != nil {
+		return err
+	}
+
+	fs.record(change{typ: changeCreated, path: name})
+
+	return nil
+}
+
+func (fs *txFs) MknodIfPossible(name string, mode os.FileMode, dev uint64) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.touch(name); err != nil {
+		return err
+	}
+
+	if err := mknod(fs.base, name, mode, dev); err != nil {
+		return err
+	}
+
+	fs.record(change{typ: changeCreated, path: name})
+
+	return nil
+}
+
+func (fs *txFs) LinkIfPossible(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.touch(newname); err != nil {
+		return err
+	}
+
+	if err := link(fs.base, oldname, newname); err != nil {
+		return err
+	}
+
+	fs.record(change{typ: changeCreated, path: newname})
+
+	return nil
+}
+
+// txSymlinkFs is a txFs over a filesystem that supports symlinks.
+type txSymlinkFs struct {
+	*txFs
+}
+
+func (fs *txSymlinkFs) SymlinkIfPossible(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.touch(newname); err != nil {
+		return err
+	}
+
+	if err := fs.base.(afero.Symlinker).SymlinkIfPossible(oldname, newname); err != nil { //nolint: forcetypeassert
+		return err
+	}
+
+	fs.record(change{typ: changeCreated, path: newname})
+
+	return nil
+}
+
+func (fs *txSymlinkFs) ReadlinkIfPossible(name string) (string, error) {
+	return fs.base.(afero.Symlinker).ReadlinkIfPossible(name) //nolint: errcheck,forcetypeassert
+}
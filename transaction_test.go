@@ -0,0 +1,253 @@
+package aferocopy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// snapshot returns every entry under root with its mode, its modification time and its content.
+func snapshot(t *testing.T, fs afero.Fs, root string) map[string]string {
+	t.Helper()
+
+	entries := make(map[string]string)
+
+	err := afero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		entry := info.Mode().String() + " " + info.ModTime().Format(time.RFC3339Nano)
+
+		if info.Mode().IsRegular() {
+			content, err := afero.ReadFile(fs, path)
+			if err != nil {
+				return err
+			}
+
+			entry += " " + string(content)
+		}
+
+		entries[path] = entry
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	return entries
+}
+
+func newTxFixtureFs(t *testing.T) afero.Fs {
+	t.Helper()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("new a"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/b.txt", []byte("new b"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/dir/c.txt", []byte("new c"), 0o600))
+	require.NoError(t, afero.WriteFile(fs, "/src/new/d.txt", []byte("new d"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/z.txt", []byte("z"), 0o644))
+
+	require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte("old a"), 0o600))
+	require.NoError(t, afero.WriteFile(fs, "/dest/dir/c.txt", []byte("old c"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dest/dir/extra.txt", []byte("extra"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dest/extra/e.txt", []byte("extra"), 0o644))
+	require.NoError(t, fs.Chmod("/dest/dir", 0o700))
+
+	return fs
+}
+
+func TestOptions_Transactional_Rollback(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario string
+		options  Options
+	}{
+		{
+			scenario: "merge",
+		},
+		{
+			scenario: "atomic",
+			options:  Options{Atomic: true},
+		},
+		{
+			scenario: "backup",
+			options:  Options{Backup: NumberedBackup},
+		},
+		{
+			scenario: "mirror",
+			options: Options{MirrorDest: true, OnDirExists: func(afero.Fs, string, afero.Fs, string) DirExistsAction {
+				return Mirror
+			}},
+		},
+		{
+			scenario: "replace",
+			options: Options{OnDirExists: func(afero.Fs, string, afero.Fs, string) DirExistsAction {
+				return Replace
+			}},
+		},
+		{
+			scenario: "continue on error",
+			options: Options{OnError: func(*CopyError) ErrorAction {
+				return Continue
+			}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			fs := newTxFixtureFs(t)
+			before := snapshot(t, fs, "/")
+
+			opt := tc.options
+			opt.SrcFs = &failingOpenFs{Fs: fs, errs: map[string]error{"/src/z.txt": errors.New("could not open")}}
+			opt.DestFs = fs
+			opt.Transactional = true
+
+			err := Copy("/src", "/dest", opt)
+			require.ErrorContains(t, err, "could not open")
+
+			assert.Equal(t, before, snapshot(t, fs, "/"))
+		})
+	}
+}
+
+func TestOptions_Transactional_Commit(t *testing.T) {
+	t.Parallel()
+
+	fs := newTxFixtureFs(t)
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:         fs,
+		Transactional: true,
+		MirrorDest:    true,
+		OnDirExists: func(afero.Fs, string, afero.Fs, string) DirExistsAction {
+			return Mirror
+		},
+	})
+	require.NoError(t, err)
+
+	// Nothing is left aside.
+	assert.Equal(t, []string{"dest", "src"}, dirNames(t, fs, "/"))
+
+	expected := map[string]string{
+		"/dest/a.txt":     "new a",
+		"/dest/b.txt":     "new b",
+		"/dest/dir/c.txt": "new c",
+		"/dest/new/d.txt": "new d",
+		"/dest/z.txt":     "z",
+	}
+
+	for name, want := range expected {
+		content, err := afero.ReadFile(fs, name)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(content), name)
+	}
+
+	assert.Equal(t, []string{"c.txt"}, dirNames(t, fs, "/dest/dir"))
+}
+
+func TestOptions_Transactional_Canceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fs := newTxFixtureFs(t)
+	before := snapshot(t, fs, "/")
+
+	err := CopyContext(ctx, "/src", "/dest", Options{
+		SrcFs:         &cancelFs{Fs: fs, cancel: cancel},
+		DestFs:        fs,
+		Transactional: true,
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	assert.Equal(t, before, snapshot(t, fs, "/"))
+}
+
+// foreignSysFs returns file infos with a Sys that is not the one of the system, like sftpfs.
+type foreignSysFs struct {
+	afero.Fs
+}
+
+type foreignSysInfo struct {
+	os.FileInfo
+}
+
+func (foreignSysInfo) Sys() any {
+	return struct{}{}
+}
+
+func (fs *foreignSysFs) Stat(name string) (os.FileInfo, error) {
+	info, err := fs.Fs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return foreignSysInfo{info}, nil
+}
+
+func (fs *foreignSysFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	info, err := fs.Stat(name)
+
+	return info, false, err
+}
+
+func TestOptions_Transactional_ForeignSys(t *testing.T) {
+	t.Parallel()
+
+	fs := newTxFixtureFs(t)
+
+	err := Copy("/src", "/dest", Options{
+		SrcFs:         fs,
+		DestFs:        &foreignSysFs{Fs: fs},
+		Transactional: true,
+	})
+	require.NoError(t, err)
+
+	content, err := afero.ReadFile(fs, "/dest/new/d.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "new d", string(content))
+}
+
+func TestOptions_Transactional_Times(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	fs := afero.NewOsFs()
+
+	src, dest := filepath.Join(dir, "src"), filepath.Join(dir, "dest")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	require.NoError(t, fs.Mkdir(src, 0o755))
+	require.NoError(t, fs.Mkdir(dest, 0o755))
+	require.NoError(t, afero.WriteFile(fs, filepath.Join(src, "a.txt"), []byte("new a"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, filepath.Join(src, "z.txt"), []byte("z"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, filepath.Join(dest, "a.txt"), []byte("old a"), 0o600))
+	require.NoError(t, fs.Chmod(dest, 0o700))
+	require.NoError(t, fs.Chtimes(dest, mtime, mtime))
+
+	before := snapshot(t, fs, dir)
+
+	err := Copy(src, dest, Options{
+		SrcFs:         &failingOpenFs{Fs: fs, errs: map[string]error{filepath.Join(src, "z.txt"): errors.New("could not open")}},
+		DestFs:        fs,
+		Transactional: true,
+		PreserveTimes: true,
+		PreserveOwner: true,
+	})
+	require.ErrorContains(t, err, "could not open")
+
+	assert.Equal(t, before, snapshot(t, fs, dir))
+}
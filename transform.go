@@ -0,0 +1,134 @@
+package aferocopy
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+)
+
+// Transformer transforms the content of a file while it is copied, like normalizing the line endings, compressing it
+// or substituting a template, by wrapping the reader of the source and the writer of the destination.
+type Transformer struct {
+	// Reader wraps the reader of the source, when not nil. The reader it returns is not closed.
+	Reader func(r io.Reader) (io.Reader, error)
+
+	// Writer wraps the writer of the destination, when not nil. The writer it returns is closed once everything is
+	// written, to flush it, like a gzip.Writer, before the destination is closed.
+	Writer func(w io.Writer) (io.WriteCloser, error)
+}
+
+// transformer returns the transformer of the file src, if any.
+func transformer(src string, info os.FileInfo, opt Options) *Transformer {
+	if opt.Transform == nil {
+		return nil
+	}
+
+	return opt.Transform(src, info)
+}
+
+// copy copies r to w through the transformer.
+func (t *Transformer) copy(w io.Writer, r io.Reader, buf []byte) (err error) {
+	if t.Reader != nil {
+		if r, err = t.Reader(r); err != nil {
+			return err
+		}
+	}
+
+	var out io.WriteCloser = nopWriteCloser{w}
+
+	if t.Writer != nil {
+		if out, err = t.Writer(w); err != nil {
+			return err
+		}
+	}
+
+	// The writer is not closed on error, so that it does not write what a complete content ends with.
+	if _, err := io.CopyBuffer(struct{ io.Writer }{out}, r, buf); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+// transformContent copies the source, already opened as r, to the destination file through the transformer, and
+// returns the number of bytes written to the destination.
+func transformContent(src, dest string, r io.Reader, sr *sourceReader, f io.Writer, opt Options) (int64, error) {
+	var buf []byte
+
+	if opt.CopyBufferSize != 0 {
+		buf = make([]byte, opt.CopyBufferSize)
+	}
+
+	dw := &destWriter{w: f}
+
+	if err := opt.transform.copy(dw, r, buf); err != nil {
+		switch {
+		case isContextError(err):
+			return dw.n, &CopyError{Op: "copy", Src: src, Dest: dest, Err: err}
+
+		case sr.err != nil && errors.Is(err, sr.err):
+			return dw.n, srcError("read", src, dest, err)
+
+		case dw.err != nil && errors.Is(err, dw.err):
+			return dw.n, destError("write", src, dest, err)
+
+		default:
+			return dw.n, &CopyError{Op: "transform", Src: src, Dest: dest, Err: err}
+		}
+	}
+
+	return dw.n, nil
+}
+
+// transformedChecksum returns the checksum of the source once transformed.
+func transformedChecksum(src, dest string, opt Options) (sum []byte, err error) {
+	s, err := opt.SrcFs.Open(src)
+	if err != nil {
+		return nil, srcError("open", src, dest, err)
+	}
+
+	defer closeFile(s, &err, func(err error) error {
+		return srcError("close", src, dest, err)
+	})
+
+	sr := &sourceReader{r: s}
+	h := sha256.New()
+
+	if err := opt.transform.copy(h, sr, nil); err != nil {
+		if sr.err != nil && errors.Is(err, sr.err) {
+			return nil, srcError("read", src, dest, err)
+		}
+
+		return nil, &CopyError{Op: "transform", Src: src, Dest: dest, Err: err}
+	}
+
+	return h.Sum(nil), nil
+}
+
+// destWriter counts the bytes written to the destination, and remembers the error of writing them,
+// so that it is not mistaken for an error of the transformer.
+type destWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *destWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+
+	if err != nil {
+		w.err = err
+	}
+
+	return n, err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,166 @@
+package aferocopy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crlfToLF is a reader that normalizes the line endings.
+func crlfToLF(r io.Reader) (io.Reader, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))), nil
+}
+
+func TestOptions_Transform(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("a\r\nb\r\n"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/data.bin", []byte("\r\n"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/log.txt", []byte(strings.Repeat("log\n", 100)), 0o644))
+
+	res, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:          fs,
+		CopyBufferSize: 16,
+		Transform: func(src string, _ os.FileInfo) *Transformer {
+			switch filepath.Base(src) {
+			case "a.txt":
+				return &Transformer{Reader: crlfToLF}
+
+			case "log.txt":
+				return &Transformer{Writer: func(w io.Writer) (io.WriteCloser, error) {
+					return gzip.NewWriter(w), nil
+				}}
+			}
+
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	content, err := afero.ReadFile(fs, "/dest/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "a\nb\n", string(content))
+
+	content, err = afero.ReadFile(fs, "/dest/data.bin")
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", string(content))
+
+	compressed, err := afero.ReadFile(fs, "/dest/log.txt")
+	require.NoError(t, err)
+
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+
+	content, err = io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("log\n", 100), string(content))
+
+	// The bytes written to the destination are counted.
+	assert.Equal(t, int64(4+2+len(compressed)), res.Bytes)
+}
+
+func TestOptions_Transform_Error(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("a"), 0o644))
+
+	err := Copy("/src/a.txt", "/dest/a.txt", Options{
+		SrcFs: fs,
+		Transform: func(string, os.FileInfo) *Transformer {
+			return &Transformer{Reader: func(io.Reader) (io.Reader, error) {
+				return nil, errors.New("cannot transform")
+			}}
+		},
+	})
+	require.ErrorContains(t, err, "cannot transform")
+
+	var cerr *CopyError
+
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, "transform", cerr.Op)
+}
+
+func TestOptions_Transform_Update(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	upper := func(string, os.FileInfo) *Transformer {
+		return &Transformer{Reader: func(r io.Reader) (io.Reader, error) {
+			content, err := io.ReadAll(r)
+
+			return bytes.NewReader(bytes.ToUpper(content)), err
+		}}
+	}
+
+	testCases := []struct {
+		scenario    string
+		mode        UpdateMode
+		destContent string
+		expected    string
+	}{
+		{
+			scenario:    "size differs but mod time is the same",
+			mode:        UpdateSizeAndModTime,
+			destContent: "HELLO!",
+			expected:    "HELLO!",
+		},
+		{
+			scenario:    "size only",
+			mode:        UpdateSizeOnly,
+			destContent: "hellO",
+			expected:    "HELLO",
+		},
+		{
+			scenario:    "transformed content is the same",
+			mode:        UpdateChecksum,
+			destContent: "HELLO",
+			expected:    "HELLO",
+		},
+		{
+			scenario:    "transformed content is different",
+			mode:        UpdateChecksum,
+			destContent: "hello",
+			expected:    "HELLO",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			fs := afero.NewMemMapFs()
+
+			require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("hello"), 0o644))
+			require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte(tc.destContent), 0o644))
+			require.NoError(t, fs.Chtimes("/src/a.txt", mtime, mtime))
+			require.NoError(t, fs.Chtimes("/dest/a.txt", mtime, mtime))
+
+			err := Copy("/src/a.txt", "/dest/a.txt", Options{SrcFs: fs, Update: tc.mode, Transform: upper})
+			require.NoError(t, err)
+
+			content, err := afero.ReadFile(fs, "/dest/a.txt")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(content))
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package aferocopy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// UpdateMode represents how to decide whether a file in the destination is up to date, so that it is not copied again.
+type UpdateMode int
+
+const (
+	// UpdateAll copies every file, even if it is up to date (default behavior).
+	UpdateAll UpdateMode = iota
+	// UpdateSizeAndModTime skips the files that have the same size and modification time, to the second, in the
+	// destination. It needs Options.PreserveTimes: without it, the files are copied with the time they are copied at,
+	// so they never have the time of the source, and are copied every time.
+	UpdateSizeAndModTime
+	// UpdateNewer skips the files that are not newer, to the second, than their destination.
+	UpdateNewer
+	// UpdateSizeOnly skips the files that have the same size in the destination.
+	UpdateSizeOnly
+	// UpdateChecksum skips the files that have the same content in the destination.
+	UpdateChecksum
+)
+
+// isUpToDate tells whether the existing destination file is up to date with the source, following Options.Update.
+// The source and the destination are only opened for UpdateChecksum.
+func isUpToDate(src, dest string, info, destInfo os.FileInfo, opt Options) (bool, error) {
+	if !destInfo.Mode().IsRegular() {
+		return false, nil
+	}
+
+	// The size of a transformed file is not the one of its source.
+	sameSize := info.Size() == destInfo.Size() || opt.transform != nil
+
+	switch opt.Update {
+	case UpdateSizeAndModTime:
+		return sameSize && info.ModTime().Unix() == destInfo.ModTime().Unix(), nil
+
+	case UpdateNewer:
+		return info.ModTime().Unix() <= destInfo.ModTime().Unix(), nil
+
+	case UpdateSizeOnly:
+		return opt.transform == nil && info.Size() == destInfo.Size(), nil
+
+	case UpdateChecksum:
+		if !sameSize {
+			return false, nil
+		}
+
+		return sameChecksum(src, dest, opt)
+
+	case UpdateAll:
+		fallthrough
+
+	default:
+		return false, nil
+	}
+}
+
+func sameChecksum(src, dest string, opt Options) (bool, error) {
+	var (
+		srcSum []byte
+		err    error
+	)
+
+	if opt.transform != nil {
+		if srcSum, err = transformedChecksum(src, dest, opt); err != nil {
+			return false, err
+		}
+	} else if srcSum, err = checksum(opt.SrcFs, src); err != nil {
+		return false, srcError("read", src, dest, err)
+	}
+
+	destSum, err := checksum(opt.DestFs, dest)
+	if err != nil {
+		return false, destError("read", src, dest, err)
+	}
+
+	return bytes.Equal(srcSum, destSum), nil
+}
+
+func checksum(fs afero.Fs, name string) (sum []byte, err error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeFile(f, &err, func(err error) error { return err })
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,180 @@
+package aferocopy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptions_Update(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		scenario    string
+		mode        UpdateMode
+		destContent string
+		destMtime   time.Time
+		expected    string
+	}{
+		{
+			scenario:    "all",
+			mode:        UpdateAll,
+			destContent: "hellO",
+			destMtime:   mtime,
+			expected:    "hello",
+		},
+		{
+			scenario:    "size and mod time are the same",
+			mode:        UpdateSizeAndModTime,
+			destContent: "hellO",
+			destMtime:   mtime.Add(500 * time.Millisecond),
+			expected:    "hellO",
+		},
+		{
+			scenario:    "size is different",
+			mode:        UpdateSizeAndModTime,
+			destContent: "hello!",
+			destMtime:   mtime,
+			expected:    "hello",
+		},
+		{
+			scenario:    "mod time is different",
+			mode:        UpdateSizeAndModTime,
+			destContent: "hellO",
+			destMtime:   mtime.Add(time.Second),
+			expected:    "hello",
+		},
+		{
+			scenario:    "destination is newer",
+			mode:        UpdateNewer,
+			destContent: "hello!",
+			destMtime:   mtime.Add(time.Hour),
+			expected:    "hello!",
+		},
+		{
+			scenario:    "destination is older",
+			mode:        UpdateNewer,
+			destContent: "hello!",
+			destMtime:   mtime.Add(-time.Hour),
+			expected:    "hello",
+		},
+		{
+			scenario:    "size only",
+			mode:        UpdateSizeOnly,
+			destContent: "hellO",
+			destMtime:   mtime.Add(-time.Hour),
+			expected:    "hellO",
+		},
+		{
+			scenario:    "checksum is different",
+			mode:        UpdateChecksum,
+			destContent: "hellO",
+			destMtime:   mtime,
+			expected:    "hello",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			srcFs := afero.NewMemMapFs()
+			destFs := afero.NewMemMapFs()
+
+			require.NoError(t, afero.WriteFile(srcFs, "/src/a.txt", []byte("hello"), 0o644))
+			require.NoError(t, srcFs.Chtimes("/src/a.txt", mtime, mtime))
+			require.NoError(t, afero.WriteFile(destFs, "/dest/a.txt", []byte(tc.destContent), 0o644))
+			require.NoError(t, destFs.Chtimes("/dest/a.txt", tc.destMtime, tc.destMtime))
+
+			err := Copy("/src", "/dest", Options{SrcFs: srcFs, DestFs: destFs, Update: tc.mode})
+			require.NoError(t, err)
+
+			content, err := afero.ReadFile(destFs, "/dest/a.txt")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(content))
+		})
+	}
+}
+
+func TestOptions_Update_Result(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "/src/a.txt", []byte("a"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/src/b.txt", []byte("b"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/dest/a.txt", []byte("a"), 0o644))
+
+	var totalBytes int64
+
+	result, err := CopyWithResult(context.Background(), "/src", "/dest", Options{
+		SrcFs:   fs,
+		Update:  UpdateChecksum,
+		PreScan: true,
+		OnProgress: func(p Progress) {
+			totalBytes = p.TotalBytes
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), result.Files)
+	assert.Equal(t, int64(1), result.Bytes)
+	assert.Equal(t, int64(2), totalBytes) // The pre-scan does not look at the destination.
+	assert.Equal(t, []SkippedEntry{{Src: "/src/a.txt", Dest: "/dest/a.txt", Reason: SkippedUpToDate}}, result.Skipped)
+}
+
+func TestOptions_Update_SizeAndModTime_PreserveTimes(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		scenario      string
+		preserveTimes bool
+		expected      []string
+	}{
+		{
+			scenario:      "preserve times",
+			preserveTimes: true,
+			expected:      []string{"a.txt"},
+		},
+		{
+			// The destination has the time it is copied at.
+			scenario: "do not preserve times",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			src, dest := filepath.Join(t.TempDir(), "src"), filepath.Join(t.TempDir(), "dest")
+			mtime := time.Now().Add(-time.Hour)
+
+			require.NoError(t, os.Mkdir(src, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o644))
+			require.NoError(t, os.Chtimes(filepath.Join(src, "a.txt"), mtime, mtime))
+
+			opt := Options{Update: UpdateSizeAndModTime, PreserveTimes: tc.preserveTimes}
+
+			require.NoError(t, Copy(src, dest, opt))
+
+			result, err := CopyWithResult(context.Background(), src, dest, opt)
+			require.NoError(t, err)
+
+			var skipped []string
+
+			for _, entry := range result.Skipped {
+				skipped = append(skipped, filepath.Base(entry.Src))
+			}
+
+			assert.Equal(t, tc.expected, skipped)
+		})
+	}
+}
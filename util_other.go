@@ -13,3 +13,10 @@ func fileInfoStat(v interface{}) *syscall.Stat_t {
 
 	return s
 }
+
+// hasFileInfoStat tells whether v is what fileInfoStat needs.
+func hasFileInfoStat(v interface{}) bool {
+	_, ok := v.(*syscall.Stat_t)
+
+	return ok
+}